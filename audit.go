@@ -0,0 +1,131 @@
+package dynjson
+
+import (
+	"context"
+	"reflect"
+)
+
+// AuditEvent records the pii fields disclosed by a formatting call.
+type AuditEvent struct {
+	// Selection are the selected fields, empty for the default selection.
+	Selection []string
+	// Paths are the dot separated paths of the pii fields returned unmasked.
+	Paths []string
+	// IDs are the identifiers of the formatted records, one per slice element or stream item output
+	// (nil ones being skipped).
+	IDs []interface{}
+}
+
+// WithAudit makes the formatter call fn after formatting values with fields tagged with dynjson:"pii",
+// once per call (for slices and streams too), the caller being told by ctx.
+//
+// idField is the JSON name of the identifier field of the formatted structs. Masked pii fields are not reported.
+func WithAudit(idField string, fn func(ctx context.Context, e AuditEvent)) FormatterOption {
+	return func(f *Formatter) {
+		f.audit = fn
+		f.idField = idField
+	}
+}
+
+// auditValue calls the audit function of f if the selection of fields disclosed the pii paths of v.
+func (f *Formatter) auditValue(ctx context.Context, pii []string, fields []string, v reflect.Value) {
+	if f.audit == nil || len(pii) == 0 {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+	}
+	e := AuditEvent{Selection: fields, Paths: pii}
+	if f.idField != "" {
+		e.IDs = f.ids(v)
+	}
+	f.audit(ctx, e)
+}
+
+// emitted returns the elements of the slice v output in o, the last ones being dropped with TruncateOverflow.
+func emitted(v reflect.Value, o interface{}) reflect.Value {
+	if v.Kind() != reflect.Slice {
+		return v
+	}
+	if ov := reflect.ValueOf(o); ov.Kind() == reflect.Slice && ov.Len() < v.Len() {
+		return v.Slice(0, ov.Len())
+	}
+	return v
+}
+
+// streamAudit collects the records written by a stream, audited once at its end.
+type streamAudit struct {
+	f      *Formatter
+	pii    []string
+	fields []string
+	// written is the number of records written.
+	written int
+	ids     []interface{}
+}
+
+// add records the written item v.
+func (a *streamAudit) add(v reflect.Value) {
+	if a.f.audit == nil || len(a.pii) == 0 || v.Kind() == reflect.Ptr && v.IsNil() {
+		return
+	}
+	a.written++
+	if a.f.idField != "" {
+		a.ids = append(a.ids, a.f.ids(v)...)
+	}
+}
+
+// done calls the audit function of the formatter if records were written.
+func (a *streamAudit) done(ctx context.Context) {
+	if a.written == 0 {
+		return
+	}
+	a.f.audit(ctx, AuditEvent{Selection: a.fields, Paths: a.pii, IDs: a.ids})
+}
+
+// ids returns the values of the identifier fields of the struct (or slice of structs) v.
+func (f *Formatter) ids(v reflect.Value) []interface{} {
+	t := v.Type()
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	b, err := f.builder(t)
+	if err != nil {
+		return nil
+	}
+	sb := structOf(b)
+	if sb == nil || sb.builders[f.idField] == nil {
+		return nil
+	}
+	index := sb.fields[f.idField].Index
+	var ids []interface{}
+	add := func(v reflect.Value) {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return
+			}
+			v = v.Elem()
+		}
+		// identifiers in nil embedded structs are skipped as well
+		if id, err := v.FieldByIndexErr(index); err == nil {
+			ids = append(ids, id.Interface())
+		}
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			add(v.Index(i))
+		}
+	} else {
+		add(v)
+	}
+	return ids
+}
@@ -0,0 +1,130 @@
+package dynjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+type auditContact struct {
+	Phone string `json:"phone" dynjson:"pii"`
+	City  string `json:"city"`
+}
+
+type auditUser struct {
+	ID      int          `json:"id"`
+	Name    string       `json:"name" dynjson:"pii"`
+	Email   string       `json:"email" dynjson:"pii,mask=email"`
+	Contact auditContact `json:"contact"`
+}
+
+func TestFormatAudit(t *testing.T) {
+	var events []AuditEvent
+	f := NewFormatter(WithAudit("id", func(ctx context.Context, e AuditEvent) {
+		events = append(events, e)
+	}))
+	src := []*auditUser{{ID: 1, Name: "John", Contact: auditContact{Phone: "0612345678", City: "Paris"}}, nil, {ID: 2, Name: "Jane"}}
+	var tests = []struct {
+		src    interface{}
+		fields []string
+		output string
+		events string
+	}{
+		{src: src, fields: []string{"id", "name", "email"}, output: `[{"id":1,"name":"John","email":""},null,{"id":2,"name":"Jane","email":""}]`, events: `[{[id name email] [name] [1 2]}]`},
+		{src: src[0], fields: []string{"contact.phone"}, output: `{"contact":{"phone":"0612345678"}}`, events: `[{[contact.phone] [contact.phone] [1]}]`},
+		{src: src, fields: []string{"id", "contact.city"}, output: `[{"id":1,"contact":{"city":"Paris"}},null,{"id":2,"contact":{"city":""}}]`, events: `[]`},
+		{src: src[0], output: `{"id":1,"name":"John","email":"","contact":{"phone":"0612345678","city":"Paris"}}`, events: `[{[] [name contact.phone] [1]}]`},
+		{src: []auditUser{}, fields: []string{"name"}, output: `[]`, events: `[]`},
+	}
+	for _, tt := range tests {
+		events = []AuditEvent{}
+		o, err := f.Format(tt.src, tt.fields)
+		if err != nil {
+			t.Fatal("Should not have returned", err)
+		}
+		buf, _ := json.Marshal(o)
+		if string(buf) != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", string(buf), tt.output)
+		}
+		if fmt.Sprint(events) != tt.events {
+			t.Errorf("Returned '%v', expected '%s'", events, tt.events)
+		}
+	}
+	events = []AuditEvent{}
+	var buf bytes.Buffer
+	err := NewCSVEncoder(&buf, f).Encode(src, []string{"id", "name"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	if fmt.Sprint(events) != `[{[id name] [name] [1 2]}]` {
+		t.Errorf("Returned '%v', expected a single event", events)
+	}
+	events = []AuditEvent{}
+	p, err := CompileWith[auditUser](f, []string{"name"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	_, err = p.FormatSlice([]auditUser{{ID: 3}, {ID: 4}})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	if fmt.Sprint(events) != `[{[name] [name] [3 4]}]` {
+		t.Errorf("Returned '%v', expected a single event", events)
+	}
+}
+
+func TestStreamAudit(t *testing.T) {
+	var events []AuditEvent
+	f := NewFormatter(WithAudit("id", func(ctx context.Context, e AuditEvent) {
+		events = append(events, e)
+	}))
+	ch := make(chan auditUser, 3)
+	ch <- auditUser{ID: 1}
+	ch <- auditUser{ID: 2}
+	ch <- auditUser{ID: 3}
+	close(ch)
+	var buf bytes.Buffer
+	err := EncodeChan(&buf, ch, []string{"id", "name"}, StreamFormatter(f))
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	if fmt.Sprint(events) != `[{[id name] [name] [1 2 3]}]` {
+		t.Errorf("Returned '%v', expected a single event", events)
+	}
+}
+
+func TestTruncatedAudit(t *testing.T) {
+	var events []AuditEvent
+	f := NewFormatter(WithAudit("id", func(ctx context.Context, e AuditEvent) {
+		events = append(events, e)
+	}), WithOutputLimits(OutputLimits{MaxSliceLength: 2}, TruncateOverflow))
+	_, err := f.Format([]auditUser{{ID: 1}, {ID: 2}, {ID: 3}}, []string{"id", "name"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	if fmt.Sprint(events) != `[{[id name] [name] [1 2]}]` {
+		t.Errorf("Returned '%v', expected '%s'", events, `[{[id name] [name] [1 2]}]`)
+	}
+	events = []AuditEvent{}
+	f = NewFormatter(WithAudit("id", func(ctx context.Context, e AuditEvent) {
+		events = append(events, e)
+	}), WithOutputLimits(OutputLimits{MaxBytes: 30}, TruncateOverflow))
+	ch := make(chan auditUser, 3)
+	ch <- auditUser{ID: 1}
+	ch <- auditUser{ID: 2}
+	ch <- auditUser{ID: 3}
+	close(ch)
+	var buf bytes.Buffer
+	err = EncodeChan(&buf, ch, []string{"id", "name"}, StreamFormatter(f))
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	if buf.String() != "[{\"id\":1,\"name\":\"\"}]\n" {
+		t.Errorf("Returned '%s', expected '%s'", buf.String(), "[{\"id\":1,\"name\":\"\"}]\n")
+	}
+	if fmt.Sprint(events) != `[{[id name] [name] [1]}]` {
+		t.Errorf("Returned '%v', expected '%s'", events, `[{[id name] [name] [1]}]`)
+	}
+}
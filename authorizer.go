@@ -0,0 +1,88 @@
+package dynjson
+
+import (
+	"context"
+	"reflect"
+)
+
+// Authorizer decides which fields callers may see.
+//
+// Its methods are called while compiling selections, concurrently for different ones, and may use the formatter.
+type Authorizer interface {
+	// Profile returns the authorization profile of the caller, compiled selections being cached per profile.
+	Profile(ctx context.Context) string
+	// Authorize reports whether the caller may see the field at path (dot separated, from the formatted value),
+	// t being the struct type holding the field. Its result must only depend on the profile of ctx.
+	Authorize(ctx context.Context, t reflect.Type, path string) bool
+}
+
+// AuthorizerPolicy defines what happens to the selected fields denied by an Authorizer.
+type AuthorizerPolicy int
+
+const (
+	// DenyForbidden makes the formatting fail with a ForbiddenFieldError.
+	DenyForbidden AuthorizerPolicy = iota
+	// DropForbidden drops the denied fields silently.
+	DropForbidden
+)
+
+// WithAuthorizer makes the formatter consult a when compiling selections, denied fields being handled according to policy.
+//
+// Selecting all the fields, or all the fields of a nested struct, selects all the authorized ones instead.
+func WithAuthorizer(a Authorizer, policy AuthorizerPolicy) FormatterOption {
+	return func(f *Formatter) {
+		f.authorizer = a
+		f.authPolicy = policy
+	}
+}
+
+// ForbiddenFieldError is returned when a selected field is denied by the Authorizer of the formatter.
+type ForbiddenFieldError struct {
+	// Path is the dot separated path of the field.
+	Path string
+}
+
+func (e *ForbiddenFieldError) Error() string {
+	return "field '" + e.Path + "' is forbidden"
+}
+
+// authorize reports whether the field at path of struct type t is authorized.
+func (c *compilation) authorize(t reflect.Type, path string) bool {
+	return c.authorizer == nil || c.authorizer.Authorize(c.ctx, t, path)
+}
+
+// unrestricted reports whether all the fields under b are authorized, unmasked, unaudited and unlimited.
+func (b *structBuilder) unrestricted(c *compilation, prefix string) bool {
+	for _, name := range b.names {
+		if !c.authorize(b.t, prefix+name) || c.masked(b.t, prefix+name, b.masks[name]) || c.audited && b.pii[name] {
+			return false
+		}
+		if _, ok := b.builders[name].(*sliceBuilder); ok && c.output != nil {
+			return false
+		}
+		if sb := structOf(b.builders[name]); sb != nil && !sb.unrestricted(c, prefix+name+".") {
+			return false
+		}
+	}
+	return true
+}
+
+// authorizedFields returns the authorized fields under b, relative to b, in declaration order,
+// structs being expanded unless unrestricted.
+func (b *structBuilder) authorizedFields(c *compilation, prefix string) []string {
+	var fields []string
+	for _, name := range b.names {
+		if !c.authorize(b.t, prefix+name) {
+			continue
+		}
+		sb := structOf(b.builders[name])
+		if sb == nil || sb.unrestricted(c, prefix+name+".") {
+			fields = append(fields, name)
+			continue
+		}
+		for _, sub := range sb.authorizedFields(c, prefix+name+".") {
+			fields = append(fields, name+"."+sub)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,205 @@
+package dynjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type authKey struct{}
+
+// roleAuthorizer denies the fields tagged with an admin dynjson option to non admin callers.
+type roleAuthorizer struct {
+	calls int
+}
+
+func (a *roleAuthorizer) Profile(ctx context.Context) string {
+	role, _ := ctx.Value(authKey{}).(string)
+	return role
+}
+
+func (a *roleAuthorizer) Authorize(ctx context.Context, t reflect.Type, path string) bool {
+	a.calls++
+	if a.Profile(ctx) == "admin" {
+		return true
+	}
+	name := path[strings.LastIndex(path, ".")+1:]
+	for i := 0; i < t.NumField(); i++ {
+		if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] == name {
+			return t.Field(i).Tag.Get("dynjson") != "admin"
+		}
+	}
+	return true
+}
+
+type authAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street" dynjson:"admin"`
+}
+
+type authUser struct {
+	Name    string        `json:"name"`
+	Email   string        `json:"email" dynjson:"admin"`
+	Address authAddress   `json:"address"`
+	Friends []*authFriend `json:"friends"`
+}
+
+type authFriend struct {
+	Name string `json:"name"`
+}
+
+func TestFormatAuthorizer(t *testing.T) {
+	src := authUser{Name: "John", Email: "john@example.com", Address: authAddress{City: "Paris", Street: "Rue de Rivoli"}, Friends: []*authFriend{{Name: "Jane"}}}
+	admin := context.WithValue(context.Background(), authKey{}, "admin")
+	var tests = []struct {
+		ctx    context.Context
+		policy AuthorizerPolicy
+		fields []string
+		output string
+		err    string
+		denied []string
+	}{
+		{ctx: admin, fields: []string{"email"}, output: `{"email":"john@example.com"}`},
+		{ctx: admin, output: `{"name":"John","email":"john@example.com","address":{"city":"Paris","street":"Rue de Rivoli"},"friends":[{"name":"Jane"}]}`},
+		{fields: []string{"name", "address.city"}, output: `{"name":"John","address":{"city":"Paris"}}`},
+		{fields: []string{"name", "email", "address.street"}, err: "field 'email' is forbidden; field 'address.street' is forbidden"},
+		{fields: []string{"address"}, output: `{"address":{"city":"Paris"}}`},
+		{output: `{"name":"John","address":{"city":"Paris"},"friends":[{"name":"Jane"}]}`},
+		{policy: DropForbidden, fields: []string{"name", "email", "address.street"}, output: `{"name":"John"}`, denied: []string{"email", "address.street"}},
+		{policy: DropForbidden, fields: []string{"email"}, output: `{}`, denied: []string{"email"}},
+	}
+	for _, tt := range tests {
+		ctx := tt.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		for _, f := range []*Formatter{NewFormatter(WithAuthorizer(&roleAuthorizer{}, tt.policy)), NewFormatter(WithAuthorizer(&roleAuthorizer{}, tt.policy), WithObjects())} {
+			var report Report
+			o, err := f.FormatContext(ctx, src, tt.fields, WithReport(&report))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("Returned '%v', expected '%s'", err, tt.err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			buf, _ := json.Marshal(o)
+			if string(buf) != tt.output {
+				t.Errorf("Returned '%s', expected '%s'", string(buf), tt.output)
+			}
+			if strings.Join(report.Denied, ",") != strings.Join(tt.denied, ",") {
+				t.Errorf("Returned %v, expected %v", report.Denied, tt.denied)
+			}
+		}
+	}
+}
+
+func TestFormatAuthorizerLimits(t *testing.T) {
+	f := NewFormatter(WithAuthorizer(&roleAuthorizer{}, DenyForbidden), WithLimits(Limits{MaxFields: 3}))
+	_, err := f.Format(authUser{}, nil)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	admin := context.WithValue(context.Background(), authKey{}, "admin")
+	_, err = f.FormatContext(admin, authUser{}, []string{"address"})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	_, err = f.FormatContext(admin, authUser{}, nil)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	_, err = f.FormatContext(admin, authUser{}, []string{"name", "email", "address"})
+	if err == nil || err.Error() != "selection fields (4) exceeds the limit (3)" {
+		t.Errorf("Returned '%v', expected '%s'", err, "selection fields (4) exceeds the limit (3)")
+	}
+}
+
+// reentrantAuthorizer formats values with the formatter it is used by.
+type reentrantAuthorizer struct {
+	f *Formatter
+}
+
+func (a *reentrantAuthorizer) Profile(ctx context.Context) string {
+	return ""
+}
+
+func (a *reentrantAuthorizer) Authorize(ctx context.Context, t reflect.Type, path string) bool {
+	if t == reflect.TypeOf(authFriend{}) {
+		return true
+	}
+	_, err := a.f.Format(authFriend{}, []string{"name"})
+	return err == nil
+}
+
+func TestFormatAuthorizerReentrant(t *testing.T) {
+	a := &reentrantAuthorizer{}
+	a.f = NewFormatter(WithAuthorizer(a, DenyForbidden))
+	o, err := a.f.Format(authUser{Name: "John"}, []string{"name"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	buf, _ := json.Marshal(o)
+	if string(buf) != `{"name":"John"}` {
+		t.Errorf("Returned '%s', expected '%s'", string(buf), `{"name":"John"}`)
+	}
+}
+
+func TestFormatAuthorizerProfiles(t *testing.T) {
+	a := &roleAuthorizer{}
+	f := NewFormatter(WithAuthorizer(a, DenyForbidden))
+	admin := context.WithValue(context.Background(), authKey{}, "admin")
+	_, err := f.FormatContext(admin, authUser{}, []string{"email"})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	calls := a.calls
+	_, err = f.FormatContext(context.Background(), authUser{}, []string{"email"})
+	if _, ok := err.(*ForbiddenFieldError); !ok {
+		t.Errorf("Returned %v, expected a ForbiddenFieldError", err)
+	}
+	_, err = f.FormatContext(admin, authUser{}, []string{"email"})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if a.calls != calls+1 {
+		t.Errorf("Returned %d calls, expected %d", a.calls, calls+1)
+	}
+}
+
+func TestCSVEncoderAuthorizer(t *testing.T) {
+	f := NewFormatter(WithAuthorizer(&roleAuthorizer{}, DenyForbidden))
+	var buf bytes.Buffer
+	err := NewCSVEncoder(&buf, f).Encode([]authUser{{Name: "John", Email: "john@example.com", Address: authAddress{City: "Paris"}}}, nil)
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	expected := "name,address.city,friends.name\nJohn,Paris,\n"
+	if buf.String() != expected {
+		t.Errorf("Returned '%s', expected '%s'", buf.String(), expected)
+	}
+}
+
+func TestHandlerAuthorizer(t *testing.T) {
+	h := Handler(func(r *http.Request) (interface{}, error) {
+		return authUser{Name: "John"}, nil
+	}, HandlerFormatter(NewFormatter(WithAuthorizer(&roleAuthorizer{}, DenyForbidden))), HandlerProblems())
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/?select=email", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Returned %d, expected %d", w.Code, http.StatusForbidden)
+	}
+	expected := `{"type":"about:blank","title":"Forbidden","status":403,"detail":"field 'email' is forbidden",` +
+		`"errors":[{"path":"email","reason":"forbidden_field","pointer":"select[0]"}]}` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Returned '%s', expected '%s'", w.Body.String(), expected)
+	}
+}
@@ -0,0 +1,741 @@
+package dynjson
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// BinaryEncoder writes the selected fields of values in a binary format (MessagePack or CBOR).
+//
+// Values are encoded following the encoding/json rules (keys, omitempty, json.Marshaler...),
+// so that decoding the output yields the same document as the JSON output.
+type BinaryEncoder struct {
+	f   *Formatter
+	w   io.Writer
+	new func() binaryWriter
+}
+
+// NewMsgPackEncoder returns a new encoder writing MessagePack to w, using f (or a new formatter if nil).
+func NewMsgPackEncoder(w io.Writer, f *Formatter) *BinaryEncoder {
+	return newBinaryEncoder(w, f, func() binaryWriter { return &msgpackWriter{} })
+}
+
+// NewCBOREncoder returns a new encoder writing CBOR (RFC 8949) to w, using f (or a new formatter if nil).
+func NewCBOREncoder(w io.Writer, f *Formatter) *BinaryEncoder {
+	return newBinaryEncoder(w, f, func() binaryWriter { return &cborWriter{} })
+}
+
+func newBinaryEncoder(w io.Writer, f *Formatter, new func() binaryWriter) *BinaryEncoder {
+	if f == nil {
+		f = NewFormatter()
+	}
+	return &BinaryEncoder{f: f, w: f.limitedWriter(w), new: new}
+}
+
+// Encode writes the encoding of the selected fields of o (or all of them if none specified).
+func (e *BinaryEncoder) Encode(o interface{}, fields []string) error {
+	return e.EncodeContext(context.Background(), o, fields)
+}
+
+// EncodeContext is like Encode, the context being available to all the formatting stages.
+func (e *BinaryEncoder) EncodeContext(ctx context.Context, o interface{}, fields []string) error {
+	fo, err := e.f.formatReflect(ctx, o, fields)
+	if err != nil {
+		return err
+	}
+	bw := e.new()
+	err = encodeBinary(bw, reflect.ValueOf(fo))
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(bw.bytes())
+	return err
+}
+
+// binaryWriter writes the data items of a binary format.
+type binaryWriter interface {
+	writeNil()
+	writeBool(b bool)
+	writeInt(i int64)
+	writeUint(u uint64)
+	writeFloat32(f float32)
+	writeFloat64(f float64)
+	writeString(s string)
+	writeArrayHeader(n int)
+	writeMapHeader(n int)
+	bytes() []byte
+}
+
+var (
+	numberType = reflect.TypeOf(json.Number(""))
+	bytesType  = reflect.TypeOf([]byte(nil))
+)
+
+// encodeBinary writes v to w, following the encoding/json rules.
+func encodeBinary(w binaryWriter, v reflect.Value) error {
+	if !v.IsValid() {
+		w.writeNil()
+		return nil
+	}
+	t := v.Type()
+	switch {
+	case t == objectType:
+		return encodeObject(w, v.Interface().(Object))
+	case t == numberType:
+		return encodeNumber(w, v.String())
+	case t.Implements(jsonMarshalerType):
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		buf, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+		return transcode(w, buf)
+	case v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(t).Implements(jsonMarshalerType):
+		// as with encoding/json, pointer receiver methods are only called on addressable values
+		return encodeBinary(w, v.Addr())
+	case t.Implements(textMarshalerType):
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		buf, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		w.writeString(string(buf))
+		return nil
+	case v.Kind() != reflect.Ptr && v.CanAddr() && reflect.PtrTo(t).Implements(textMarshalerType):
+		return encodeBinary(w, v.Addr())
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32:
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, 32)}
+		}
+		w.writeFloat32(float32(f))
+	case reflect.Float64:
+		f := v.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, 64)}
+		}
+		w.writeFloat64(f)
+	case reflect.String:
+		w.writeString(v.String())
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		return encodeBinary(w, v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 && !reflect.PtrTo(t.Elem()).Implements(jsonMarshalerType) &&
+			!reflect.PtrTo(t.Elem()).Implements(textMarshalerType) {
+			w.writeString(base64.StdEncoding.EncodeToString(v.Convert(bytesType).Bytes()))
+			return nil
+		}
+		return encodeArray(w, v)
+	case reflect.Array:
+		return encodeArray(w, v)
+	case reflect.Map:
+		return encodeMap(w, v)
+	case reflect.Struct:
+		return encodeStruct(w, v)
+	default:
+		return &json.UnsupportedTypeError{Type: t}
+	}
+	return nil
+}
+
+func encodeArray(w binaryWriter, v reflect.Value) error {
+	w.writeArrayHeader(v.Len())
+	for i := 0; i < v.Len(); i++ {
+		err := encodeBinary(w, v.Index(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeMap(w binaryWriter, v reflect.Value) error {
+	if v.IsNil() {
+		w.writeNil()
+		return nil
+	}
+	type entry struct {
+		key string
+		val reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		k := iter.Key()
+		var key string
+		switch {
+		case k.Kind() == reflect.String:
+			key = k.String()
+		case k.Type().Implements(textMarshalerType):
+			if k.Kind() == reflect.Ptr && k.IsNil() {
+				break
+			}
+			buf, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				return err
+			}
+			key = string(buf)
+		case k.Kind() >= reflect.Int && k.Kind() <= reflect.Int64:
+			key = strconv.FormatInt(k.Int(), 10)
+		case k.Kind() >= reflect.Uint && k.Kind() <= reflect.Uintptr:
+			key = strconv.FormatUint(k.Uint(), 10)
+		default:
+			return &json.UnsupportedTypeError{Type: v.Type()}
+		}
+		entries = append(entries, entry{key: key, val: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	w.writeMapHeader(len(entries))
+	for _, e := range entries {
+		w.writeString(e.key)
+		err := encodeBinary(w, e.val)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeObject(w binaryWriter, o Object) error {
+	if o == nil {
+		w.writeNil()
+		return nil
+	}
+	w.writeMapHeader(len(o))
+	for _, m := range o {
+		w.writeString(m.Key)
+		err := encodeBinary(w, reflect.ValueOf(m.Value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeStruct(w binaryWriter, v reflect.Value) error {
+	type member struct {
+		f  *jsonField
+		fv reflect.Value
+	}
+	fields := jsonFields(v.Type())
+	members := make([]member, 0, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		fv, ok := fieldByIndex(v, f.index)
+		if !ok || f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		members = append(members, member{f: f, fv: fv})
+	}
+	w.writeMapHeader(len(members))
+	for _, m := range members {
+		w.writeString(m.f.name)
+		if m.f.quoted {
+			err := encodeQuoted(w, m.fv)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := encodeBinary(w, m.fv)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex, returning false when traversing a nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// encodeQuoted writes v as a string, as the string option of json tags does.
+func encodeQuoted(w binaryWriter, v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		v = v.Elem()
+	}
+	s, ok, err := quotedJSON(v)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return encodeBinary(w, v)
+	}
+	w.writeString(s)
+	return nil
+}
+
+// quotedJSON returns the JSON encoding of v, which is not a pointer, quoted by the string option of json tags,
+// or false if the option does not apply to v.
+func quotedJSON(v reflect.Value) (string, bool, error) {
+	if isMarshaler(v) {
+		// the option is ignored by marshalers
+		return "", false, nil
+	}
+	var jw JSONWriter
+	switch v.Kind() {
+	case reflect.Bool:
+		jw.Bool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		jw.Int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		jw.Uint(v.Uint())
+	case reflect.Float32:
+		if err := jw.Float(v.Float(), 32); err != nil {
+			return "", false, err
+		}
+	case reflect.Float64:
+		if err := jw.Float(v.Float(), 64); err != nil {
+			return "", false, err
+		}
+	case reflect.String:
+		jw.String(v.String())
+	default:
+		return "", false, nil
+	}
+	return string(jw.Bytes()), true, nil
+}
+
+// isMarshaler reports whether encoding/json encodes v with a MarshalJSON or MarshalText method.
+func isMarshaler(v reflect.Value) bool {
+	t := v.Type()
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	return v.CanAddr() && (reflect.PtrTo(t).Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType))
+}
+
+func encodeNumber(w binaryWriter, s string) error {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		w.writeInt(i)
+		return nil
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		w.writeUint(u)
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return err
+	}
+	w.writeFloat64(f)
+	return nil
+}
+
+// transcode writes the JSON document buf to w, keeping the order of object keys.
+func transcode(w binaryWriter, buf []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	v, err := decodeOrdered(dec)
+	if err != nil {
+		return err
+	}
+	return encodeBinary(w, reflect.ValueOf(v))
+}
+
+// decodeOrdered decodes the next JSON value of dec, objects being decoded as Object values.
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		o := Object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			val, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			o = append(o, Member{Key: key.(string), Value: val})
+		}
+		_, err = dec.Token()
+		return o, err
+	case json.Delim('['):
+		a := []interface{}{}
+		for dec.More() {
+			val, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, val)
+		}
+		_, err = dec.Token()
+		return a, err
+	}
+	return tok, nil
+}
+
+// jsonField is a struct field encoded by encoding/json.
+type jsonField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	quoted    bool
+	tagged    bool
+}
+
+var jsonFieldsCache sync.Map // map[reflect.Type][]jsonField
+
+// jsonFields returns the fields of t encoded by encoding/json, following its rules for embedded structs.
+func jsonFields(t reflect.Type) []jsonField {
+	if fields, ok := jsonFieldsCache.Load(t); ok {
+		return fields.([]jsonField)
+	}
+	var all []jsonField
+	collectJSONFields(t, nil, map[reflect.Type]bool{}, &all)
+	// keep the dominant field of each name: the shallowest one, tagged ones first, ambiguous ones dropped
+	byName := map[string][]jsonField{}
+	for _, f := range all {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	var fields []jsonField
+	for _, f := range all {
+		candidates := byName[f.name]
+		if dominant, ok := dominantField(candidates); ok && sameIndex(dominant.index, f.index) {
+			fields = append(fields, f)
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return lessIndex(fields[i].index, fields[j].index) })
+	jsonFieldsCache.Store(t, fields)
+	return fields
+}
+
+func collectJSONFields(t reflect.Type, index []int, visited map[reflect.Type]bool, fields *[]jsonField) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous {
+			if !sf.IsExported() && ft.Kind() != reflect.Struct {
+				continue
+			}
+		} else if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		fi := append(append([]int{}, index...), i)
+		if opts[0] == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+			collectJSONFields(ft, fi, visited, fields)
+			continue
+		}
+		f := jsonField{name: opts[0], index: fi, tagged: opts[0] != ""}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "omitempty":
+				f.omitEmpty = true
+			case "string":
+				switch ft.Kind() {
+				case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+					reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+					reflect.Float32, reflect.Float64, reflect.String:
+					f.quoted = true
+				}
+			}
+		}
+		*fields = append(*fields, f)
+	}
+}
+
+func dominantField(fields []jsonField) (jsonField, bool) {
+	depth := len(fields[0].index)
+	for _, f := range fields {
+		if len(f.index) < depth {
+			depth = len(f.index)
+		}
+	}
+	var shallow []jsonField
+	for _, f := range fields {
+		if len(f.index) == depth {
+			shallow = append(shallow, f)
+		}
+	}
+	if len(shallow) == 1 {
+		return shallow[0], true
+	}
+	var tagged []jsonField
+	for _, f := range shallow {
+		if f.tagged {
+			tagged = append(tagged, f)
+		}
+	}
+	if len(tagged) == 1 {
+		return tagged[0], true
+	}
+	return jsonField{}, false
+}
+
+func sameIndex(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func lessIndex(a, b []int) bool {
+	for i := range a {
+		if i >= len(b) {
+			return false
+		}
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// msgpackWriter writes MessagePack data items.
+type msgpackWriter struct {
+	buf []byte
+}
+
+func (w *msgpackWriter) bytes() []byte {
+	return w.buf
+}
+
+func (w *msgpackWriter) writeNil() {
+	w.buf = append(w.buf, 0xc0)
+}
+
+func (w *msgpackWriter) writeBool(b bool) {
+	if b {
+		w.buf = append(w.buf, 0xc3)
+	} else {
+		w.buf = append(w.buf, 0xc2)
+	}
+}
+
+func (w *msgpackWriter) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		w.writeUint(uint64(i))
+	case i >= -32:
+		w.buf = append(w.buf, byte(i))
+	case i >= math.MinInt8:
+		w.buf = append(w.buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		w.buf = appendUint16(append(w.buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		w.buf = appendUint32(append(w.buf, 0xd2), uint32(i))
+	default:
+		w.buf = appendUint64(append(w.buf, 0xd3), uint64(i))
+	}
+}
+
+func (w *msgpackWriter) writeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		w.buf = append(w.buf, byte(u))
+	case u <= math.MaxUint8:
+		w.buf = append(w.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		w.buf = appendUint16(append(w.buf, 0xcd), uint16(u))
+	case u <= math.MaxUint32:
+		w.buf = appendUint32(append(w.buf, 0xce), uint32(u))
+	default:
+		w.buf = appendUint64(append(w.buf, 0xcf), u)
+	}
+}
+
+func (w *msgpackWriter) writeFloat32(f float32) {
+	w.buf = appendUint32(append(w.buf, 0xca), math.Float32bits(f))
+}
+
+func (w *msgpackWriter) writeFloat64(f float64) {
+	w.buf = appendUint64(append(w.buf, 0xcb), math.Float64bits(f))
+}
+
+func (w *msgpackWriter) writeString(s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		w.buf = append(w.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		w.buf = append(w.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = appendUint16(append(w.buf, 0xda), uint16(n))
+	default:
+		w.buf = appendUint32(append(w.buf, 0xdb), uint32(n))
+	}
+	w.buf = append(w.buf, s...)
+}
+
+func (w *msgpackWriter) writeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		w.buf = append(w.buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		w.buf = appendUint16(append(w.buf, 0xdc), uint16(n))
+	default:
+		w.buf = appendUint32(append(w.buf, 0xdd), uint32(n))
+	}
+}
+
+func (w *msgpackWriter) writeMapHeader(n int) {
+	switch {
+	case n < 16:
+		w.buf = append(w.buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		w.buf = appendUint16(append(w.buf, 0xde), uint16(n))
+	default:
+		w.buf = appendUint32(append(w.buf, 0xdf), uint32(n))
+	}
+}
+
+// cborWriter writes CBOR data items.
+type cborWriter struct {
+	buf []byte
+}
+
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+)
+
+func (w *cborWriter) bytes() []byte {
+	return w.buf
+}
+
+func (w *cborWriter) writeHeader(major byte, n uint64) {
+	switch {
+	case n < 24:
+		w.buf = append(w.buf, major|byte(n))
+	case n <= math.MaxUint8:
+		w.buf = append(w.buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = appendUint16(append(w.buf, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		w.buf = appendUint32(append(w.buf, major|26), uint32(n))
+	default:
+		w.buf = appendUint64(append(w.buf, major|27), n)
+	}
+}
+
+func (w *cborWriter) writeNil() {
+	w.buf = append(w.buf, 0xf6)
+}
+
+func (w *cborWriter) writeBool(b bool) {
+	if b {
+		w.buf = append(w.buf, 0xf5)
+	} else {
+		w.buf = append(w.buf, 0xf4)
+	}
+}
+
+func (w *cborWriter) writeInt(i int64) {
+	if i >= 0 {
+		w.writeHeader(cborUint, uint64(i))
+		return
+	}
+	w.writeHeader(cborNegInt, uint64(-1-i))
+}
+
+func (w *cborWriter) writeUint(u uint64) {
+	w.writeHeader(cborUint, u)
+}
+
+func (w *cborWriter) writeFloat32(f float32) {
+	w.buf = appendUint32(append(w.buf, 0xfa), math.Float32bits(f))
+}
+
+func (w *cborWriter) writeFloat64(f float64) {
+	w.buf = appendUint64(append(w.buf, 0xfb), math.Float64bits(f))
+}
+
+func (w *cborWriter) writeString(s string) {
+	w.writeHeader(cborText, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *cborWriter) writeArrayHeader(n int) {
+	w.writeHeader(cborArray, uint64(n))
+}
+
+func (w *cborWriter) writeMapHeader(n int) {
+	w.writeHeader(cborMap, uint64(n))
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
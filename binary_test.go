@@ -0,0 +1,324 @@
+package dynjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// binaryDecoder converts MessagePack or CBOR to JSON.
+type binaryDecoder struct {
+	buf []byte
+	out bytes.Buffer
+}
+
+func (d *binaryDecoder) next(n int) []byte {
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *binaryDecoder) uint(n int) uint64 {
+	b := d.next(n)
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u
+}
+
+func (d *binaryDecoder) marshal(v interface{}) {
+	buf, _ := json.Marshal(v)
+	d.out.Write(buf)
+}
+
+func (d *binaryDecoder) msgpack() {
+	c := d.next(1)[0]
+	switch {
+	case c <= 0x7f:
+		d.out.WriteString(strconv.Itoa(int(c)))
+	case c >= 0xe0:
+		d.out.WriteString(strconv.Itoa(int(int8(c))))
+	case c&0xe0 == 0xa0:
+		d.marshal(string(d.next(int(c & 0x1f))))
+	case c&0xf0 == 0x90:
+		d.msgpackArray(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		d.msgpackMap(int(c & 0x0f))
+	case c == 0xc0:
+		d.out.WriteString("null")
+	case c == 0xc2:
+		d.out.WriteString("false")
+	case c == 0xc3:
+		d.out.WriteString("true")
+	case c >= 0xcc && c <= 0xcf:
+		d.out.WriteString(strconv.FormatUint(d.uint(1<<(c-0xcc)), 10))
+	case c >= 0xd0 && c <= 0xd3:
+		n := 1 << (c - 0xd0)
+		u := d.uint(n)
+		d.out.WriteString(strconv.FormatInt(int64(u<<(64-8*n))>>(64-8*n), 10))
+	case c == 0xca:
+		d.marshal(math.Float32frombits(uint32(d.uint(4))))
+	case c == 0xcb:
+		d.marshal(math.Float64frombits(d.uint(8)))
+	case c >= 0xd9 && c <= 0xdb:
+		d.marshal(string(d.next(int(d.uint(1 << (c - 0xd9))))))
+	case c == 0xdc || c == 0xdd:
+		d.msgpackArray(int(d.uint(2 << (c - 0xdc))))
+	case c == 0xde || c == 0xdf:
+		d.msgpackMap(int(d.uint(2 << (c - 0xde))))
+	default:
+		panic(fmt.Sprintf("unexpected msgpack byte %x", c))
+	}
+}
+
+func (d *binaryDecoder) msgpackArray(n int) {
+	d.out.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.out.WriteByte(',')
+		}
+		d.msgpack()
+	}
+	d.out.WriteByte(']')
+}
+
+func (d *binaryDecoder) msgpackMap(n int) {
+	d.out.WriteByte('{')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			d.out.WriteByte(',')
+		}
+		d.msgpack()
+		d.out.WriteByte(':')
+		d.msgpack()
+	}
+	d.out.WriteByte('}')
+}
+
+func (d *binaryDecoder) cbor() {
+	c := d.next(1)[0]
+	major, info := c>>5, c&0x1f
+	switch c {
+	case 0xf4:
+		d.out.WriteString("false")
+		return
+	case 0xf5:
+		d.out.WriteString("true")
+		return
+	case 0xf6:
+		d.out.WriteString("null")
+		return
+	case 0xfa:
+		d.marshal(math.Float32frombits(uint32(d.uint(4))))
+		return
+	case 0xfb:
+		d.marshal(math.Float64frombits(d.uint(8)))
+		return
+	}
+	n := uint64(info)
+	if info >= 24 {
+		n = d.uint(1 << (info - 24))
+	}
+	switch major {
+	case 0:
+		d.out.WriteString(strconv.FormatUint(n, 10))
+	case 1:
+		d.out.WriteString(strconv.FormatInt(-1-int64(n), 10))
+	case 3:
+		d.marshal(string(d.next(int(n))))
+	case 4:
+		d.out.WriteByte('[')
+		for i := uint64(0); i < n; i++ {
+			if i > 0 {
+				d.out.WriteByte(',')
+			}
+			d.cbor()
+		}
+		d.out.WriteByte(']')
+	case 5:
+		d.out.WriteByte('{')
+		for i := uint64(0); i < n; i++ {
+			if i > 0 {
+				d.out.WriteByte(',')
+			}
+			d.cbor()
+			d.out.WriteByte(':')
+			d.cbor()
+		}
+		d.out.WriteByte('}')
+	default:
+		panic(fmt.Sprintf("unexpected cbor byte %x", c))
+	}
+}
+
+type binaryEmbedded struct {
+	Foo int    `json:"foo"`
+	Bar string `json:"bar"`
+}
+
+type binaryItem struct {
+	Key   string  `json:"key"`
+	Value float32 `json:"value,omitempty"`
+}
+
+// binaryMarshaler has a pointer receiver MarshalJSON method, only called by encoding/json on addressable values.
+type binaryMarshaler struct {
+	Foo int `json:"foo"`
+}
+
+func (m *binaryMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`"marshaled"`), nil
+}
+
+type binarySource struct {
+	binaryEmbedded
+	ID        int64             `json:"id,string"`
+	Neg       int               `json:"neg"`
+	Big       uint64            `json:"big"`
+	Name      string            `json:"name"`
+	Long      string            `json:"long"`
+	Ptr       *binaryItem       `json:"ptr"`
+	Nil       *binaryItem       `json:"nil"`
+	Items     []binaryItem      `json:"items,omitempty"`
+	Raw       []byte            `json:"raw"`
+	Map       map[string]int    `json:"map"`
+	IntMap    map[int]string    `json:"int_map"`
+	Time      time.Time         `json:"time"`
+	Any       interface{}       `json:"any"`
+	Message   json.RawMessage   `json:"message"`
+	Empty     map[string]string `json:"empty,omitempty"`
+	Bar       bool              `json:"bar"`
+	Quoted    *int              `json:"quoted,string"`
+	NilQuoted *int              `json:"nil_quoted,string"`
+	Marshaler binaryMarshaler   `json:"marshaler"`
+	OmitPtr   *int              `json:"omit_ptr,omitempty"`
+	NilPtr    *int              `json:"nil_ptr,omitempty"`
+}
+
+func TestBinaryEncoders(t *testing.T) {
+	long := string(bytes.Repeat([]byte("x"), 300))
+	quoted := 5
+	src := binarySource{
+		binaryEmbedded: binaryEmbedded{Foo: 1, Bar: "hidden"},
+		ID:             42,
+		Neg:            -70000,
+		Big:            math.MaxUint64,
+		Name:           "name",
+		Long:           long,
+		Ptr:            &binaryItem{Key: "a", Value: 1.1},
+		Items:          []binaryItem{{Key: "b"}, {Key: "c", Value: -2.5}},
+		Raw:            []byte("raw"),
+		Map:            map[string]int{"z": 1, "a": -1},
+		IntMap:         map[int]string{2: "b", 10: "a"},
+		Time:           time.Date(2021, 10, 11, 12, 0, 0, 0, time.UTC),
+		Any:            []interface{}{1, "x", nil, 0.5},
+		Message:        json.RawMessage(`{"z":1,"a":[true,null,1.5]}`),
+		Bar:            true,
+		Quoted:         &quoted,
+		Marshaler:      binaryMarshaler{Foo: 1},
+		OmitPtr:        new(int),
+	}
+	var tests = []struct {
+		src     interface{}
+		fields  []string
+		objects bool
+	}{
+		{src: src},
+		{src: &src},
+		{src: src, fields: []string{"long", "id", "items.value", "ptr.key", "nil", "time", "message"}},
+		{src: []binarySource{src, {}}, fields: []string{"neg", "big", "raw", "map", "int_map", "any", "bar"}},
+		{src: src, fields: []string{"items.value", "ptr", "id", "empty"}, objects: true},
+		{src: src, fields: []string{"quoted", "nil_quoted", "marshaler", "omit_ptr", "nil_ptr"}},
+		{src: []binarySource{src}, fields: []string{"quoted", "marshaler", "omit_ptr", "nil_ptr"}},
+		{src: src, fields: []string{"quoted", "marshaler", "omit_ptr"}, objects: true},
+	}
+	for i, tt := range tests {
+		f := NewFormatter()
+		if tt.objects {
+			f = NewFormatter(WithObjects())
+		}
+		o, err := f.Format(tt.src, tt.fields)
+		if err != nil {
+			t.Fatal("Should not have returned", err)
+		}
+		expected, err := json.Marshal(o)
+		if err != nil {
+			t.Fatal("Should not have returned", err)
+		}
+		for _, format := range []string{"msgpack", "cbor"} {
+			var w bytes.Buffer
+			e := NewMsgPackEncoder(&w, f)
+			if format == "cbor" {
+				e = NewCBOREncoder(&w, f)
+			}
+			err = e.Encode(tt.src, tt.fields)
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			d := binaryDecoder{buf: w.Bytes()}
+			if format == "cbor" {
+				d.cbor()
+			} else {
+				d.msgpack()
+			}
+			if len(d.buf) != 0 {
+				t.Errorf("test #%d %s: %d trailing bytes", i, format, len(d.buf))
+			}
+			if d.out.String() != string(expected) {
+				t.Errorf("test #%d %s: returned '%s', expected '%s'", i, format, d.out.String(), string(expected))
+			}
+		}
+	}
+}
+
+func TestBinaryEncodersHeaders(t *testing.T) {
+	var tests = []struct {
+		v       interface{}
+		msgpack []byte
+		cbor    []byte
+	}{
+		{v: 0, msgpack: []byte{0x00}, cbor: []byte{0x00}},
+		{v: -1, msgpack: []byte{0xff}, cbor: []byte{0x20}},
+		{v: 500, msgpack: []byte{0xcd, 0x01, 0xf4}, cbor: []byte{0x19, 0x01, 0xf4}},
+		{v: -500, msgpack: []byte{0xd1, 0xfe, 0x0c}, cbor: []byte{0x39, 0x01, 0xf3}},
+		{v: "a", msgpack: []byte{0xa1, 'a'}, cbor: []byte{0x61, 'a'}},
+		{v: []int{}, msgpack: []byte{0x90}, cbor: []byte{0x80}},
+		{v: false, msgpack: []byte{0xc2}, cbor: []byte{0xf4}},
+		{v: 1.5, msgpack: []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}, cbor: []byte{0xfb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		var w bytes.Buffer
+		err := NewMsgPackEncoder(&w, nil).Encode(tt.v, nil)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if !bytes.Equal(w.Bytes(), tt.msgpack) {
+			t.Errorf("%v: returned %x, expected %x", tt.v, w.Bytes(), tt.msgpack)
+		}
+		w.Reset()
+		err = NewCBOREncoder(&w, nil).Encode(tt.v, nil)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if !bytes.Equal(w.Bytes(), tt.cbor) {
+			t.Errorf("%v: returned %x, expected %x", tt.v, w.Bytes(), tt.cbor)
+		}
+	}
+}
+
+func TestBinaryEncodersError(t *testing.T) {
+	var w bytes.Buffer
+	err := NewCBOREncoder(&w, nil).Encode(struct{ F func() }{}, nil)
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+	err = NewMsgPackEncoder(&w, nil).Encode(math.NaN(), nil)
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+}
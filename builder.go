@@ -1,28 +1,88 @@
 package dynjson
 
 import (
+	"context"
 	"reflect"
 )
 
+// compilation holds the settings used by builders while compiling a selection.
+type compilation struct {
+	objects bool
+	lenient bool
+	pool    *workerPool
+	// ignored are the unknown paths dropped in lenient mode.
+	ignored []string
+	// costs are the registered field costs, by struct type.
+	costs map[reflect.Type]map[string]int
+	// sliceMul multiplies the cost of the fields under slices.
+	sliceMul int
+	// factor is the multiplier of the fields being compiled.
+	factor int
+	// cost is the cost of the fields compiled so far.
+	cost int
+	// count is the number of leaf fields compiled so far, selections of whole subtrees included.
+	count int
+	// ctx is the context giving the authorization profile.
+	ctx        context.Context
+	authorizer Authorizer
+	// drop makes unauthorized fields dropped instead of denied.
+	drop bool
+	// denied are the unauthorized paths dropped.
+	denied []string
+	// expanded tells whether selections have been expanded to the authorized fields
+	// (or to the fields to mask), selected holding the resulting fields.
+	expanded bool
+	selected []string
+	maskers  map[string]Masker
+	// masks is the number of masked fields.
+	masks int
+	// audited makes the pii fields expanded from selections, pii holding the unmasked ones selected.
+	audited bool
+	pii     []string
+	// output are the element limits of slices, if any.
+	output *outputConfig
+}
+
 type builder interface {
-	build(fields []string, prefix string) (formatter, error)
+	build(c *compilation, fields []string, prefix string) (formatter, error)
 }
 
-func makeBuilder(t reflect.Type) (builder, error) {
+// makeBuilder returns the builder of t, building holding the struct types whose builders are being made.
+// Fields of recursive types are built as primitives, so that they can only be selected as a whole.
+func makeBuilder(t reflect.Type, building map[reflect.Type]bool) (builder, error) {
+	if recursive(t, building) {
+		return makePrimitiveBuilder(t)
+	}
 	switch t.Kind() {
 	case reflect.Struct:
-		return makeStructBuilder(t)
+		return makeStructBuilder(t, building)
 	case reflect.Ptr:
 		if t.Elem().Kind() != reflect.Struct {
 			return makePrimitiveBuilder(t)
 		}
-		return makePointerBuilder(t)
+		return makePointerBuilder(t, building)
 	case reflect.Slice:
-		if t.Elem().Kind() != reflect.Struct {
+		if !isStructOrStructPointer(t.Elem()) {
 			return makePrimitiveBuilder(t)
 		}
-		return makeSliceBuilder(t)
+		return makeSliceBuilder(t, building)
 	default:
 		return makePrimitiveBuilder(t)
 	}
 }
+
+// recursive reports whether the struct of t, a struct or a pointer or slice of them, is being built.
+func recursive(t reflect.Type, building map[reflect.Type]bool) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return building[t]
+}
+
+// isStructOrStructPointer reports whether t is a struct or a pointer to a struct.
+func isStructOrStructPointer(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
+}
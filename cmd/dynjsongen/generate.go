@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// field is a JSON encoded field of a struct.
+type field struct {
+	name      string
+	goName    string
+	typ       ast.Expr
+	omitEmpty bool
+	quoted    bool
+}
+
+// generator generates the ProjectJSON methods of a package.
+type generator struct {
+	buf bytes.Buffer
+	// decls are the type declarations of the package.
+	decls map[string]ast.Expr
+	// generated are the struct types getting a ProjectJSON method.
+	generated map[string]bool
+	// marshalers are the types of the package implementing json.Marshaler or encoding.TextMarshaler.
+	marshalers map[string]bool
+}
+
+// generate returns the source of the ProjectJSON methods of the struct types of file.
+func generate(file string, types []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, filepath.Dir(file), func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	g := generator{
+		decls:      map[string]ast.Expr{},
+		generated:  map[string]bool{},
+		marshalers: map[string]bool{},
+	}
+	var (
+		pkgName string
+		target  *ast.File
+	)
+	for name, pkg := range pkgs {
+		for path, f := range pkg.Files {
+			if filepath.Base(path) != filepath.Base(file) {
+				continue
+			}
+			pkgName, target = name, f
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("%s: file not found", file)
+	}
+	for path, f := range pkgs[pkgName].Files {
+		if strings.HasSuffix(path, "_dynjson.go") {
+			continue
+		}
+		g.collect(f)
+	}
+
+	var structs []string
+	for _, decl := range target.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if _, ok := ts.Type.(*ast.StructType); ok && ts.TypeParams == nil {
+				structs = append(structs, ts.Name.Name)
+			}
+		}
+	}
+	if len(types) > 0 {
+		for _, t := range types {
+			if _, ok := g.decls[t].(*ast.StructType); !ok {
+				return nil, fmt.Errorf("%s: struct type %s not found", file, t)
+			}
+		}
+		structs = types
+	}
+	for _, name := range structs {
+		g.generated[name] = true
+	}
+
+	fmt.Fprintf(&g.buf, "// Code generated by dynjsongen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&g.buf, "package %s\n\n", pkgName)
+	fmt.Fprintf(&g.buf, "import \"github.com/cocoonspace/dynjson\"\n")
+	for _, name := range structs {
+		err := g.generateStruct(name, g.decls[name].(*ast.StructType))
+		if err != nil {
+			return nil, err
+		}
+	}
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("invalid generated code: %v", err)
+	}
+	return src, nil
+}
+
+// collect records the type declarations and marshalers of f.
+func (g *generator) collect(f *ast.File) {
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				ts := spec.(*ast.TypeSpec)
+				g.decls[ts.Name.Name] = ts.Type
+			}
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) != 1 {
+				continue
+			}
+			if d.Name.Name != "MarshalJSON" && d.Name.Name != "MarshalText" {
+				continue
+			}
+			recv := d.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if id, ok := recv.(*ast.Ident); ok {
+				g.marshalers[id.Name] = true
+			}
+		}
+	}
+}
+
+// fields returns the JSON encoded fields of st, following the rules of dynjson.
+func (g *generator) fields(name string, st *ast.StructType) ([]field, error) {
+	var fields []field
+	for _, f := range st.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			s, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s)
+		}
+		goNames := []string{}
+		for _, n := range f.Names {
+			goNames = append(goNames, n.Name)
+		}
+		if len(f.Names) == 0 {
+			goNames = append(goNames, embeddedName(f.Type))
+		}
+		for _, goName := range goNames {
+			if !ast.IsExported(goName) {
+				continue
+			}
+			jsonTag := tag.Get("json")
+			if jsonTag == "-" {
+				continue
+			}
+			opts := strings.Split(jsonTag, ",")
+			fld := field{name: opts[0], goName: goName, typ: f.Type}
+			if fld.name == "" {
+				fld.name = goName
+			}
+			for _, opt := range opts[1:] {
+				switch opt {
+				case "omitempty":
+					fld.omitEmpty = true
+				case "string":
+					fld.quoted = true
+				}
+			}
+			fields = append(fields, fld)
+		}
+	}
+	return fields, nil
+}
+
+func embeddedName(t ast.Expr) string {
+	switch t := t.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generateStruct(name string, st *ast.StructType) error {
+	fields, err := g.fields(name, st)
+	if err != nil {
+		return err
+	}
+	all := "dynjsonSelection" + name
+	g.printf("\nvar %s = dynjson.Selection{\n", all)
+	for _, f := range fields {
+		g.printf("{Name: %q},\n", f.name)
+	}
+	g.printf("}\n")
+
+	g.printf("\n// ProjectJSON implements dynjson.Projector.\n")
+	g.printf("func (v %s) ProjectJSON(w *dynjson.JSONWriter, sel dynjson.Selection) error {\n", name)
+	g.printf("all := len(sel) == 0\n")
+	g.printf("if all {\nsel = %s\n}\n", all)
+	g.printf("w.Byte('{')\n")
+	g.printf("n := 0\n")
+	g.printf("for _, f := range sel {\n")
+	g.printf("switch f.Name {\n")
+	for _, f := range fields {
+		expr := "v." + f.goName
+		g.printf("case %q:\n", f.name)
+		if g.isLeaf(f.typ) {
+			g.printf("if len(f.Fields) > 0 {\nreturn dynjson.UnknownField(%q + f.Fields.Paths()[0])\n}\n", f.name+".")
+		}
+		if f.omitEmpty {
+			if empty := g.empty(expr, f.typ); empty != "" {
+				g.printf("if %s {\ncontinue\n}\n", empty)
+			}
+		}
+		key, err := jsonKey(f.name)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", name, f.goName, err)
+		}
+		g.printf("if n > 0 {\nw.Byte(',')\n}\nn++\n")
+		g.printf("w.Raw(`%s`)\n", key)
+		if f.quoted && g.isQuotable(f.typ) {
+			g.quotedValue(expr, f.typ)
+			continue
+		}
+		if f.quoted && isImported(f.typ) {
+			// the option depends on the kind of the type
+			return fmt.Errorf("%s.%s: the string option is not supported on imported types", name, f.goName)
+		}
+		g.value(expr, f.typ, "f.Fields", 0)
+	}
+	g.printf("default:\nreturn dynjson.UnknownField(f.Name)\n")
+	g.printf("}\n}\n")
+	g.printf("w.Byte('}')\n")
+	g.printf("return nil\n}\n")
+	return nil
+}
+
+// jsonKey returns the JSON encoding of the object key name, followed by a colon.
+func jsonKey(name string) (string, error) {
+	if !isSimpleKey(name) {
+		return "", fmt.Errorf("unsupported JSON key %q", name)
+	}
+	return strconv.Quote(name) + ":", nil
+}
+
+// isSimpleKey reports whether the JSON and Go quoting of name are identical.
+func isSimpleKey(name string) bool {
+	for _, c := range name {
+		if c < 0x20 || c >= 0x7f || c == '"' || c == '\\' || c == '`' || c == '<' || c == '>' || c == '&' {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	signedTypes   = map[string]bool{"int": true, "int8": true, "int16": true, "int32": true, "int64": true, "rune": true}
+	unsignedTypes = map[string]bool{"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true, "byte": true}
+)
+
+// underlying returns the basic or composite type under t when it is known and has no custom marshaling.
+func (g *generator) underlying(t ast.Expr) ast.Expr {
+	for i := 0; i < 10; i++ {
+		id, ok := t.(*ast.Ident)
+		if !ok {
+			return t
+		}
+		decl, found := g.decls[id.Name]
+		if !found || g.generated[id.Name] || g.marshalers[id.Name] {
+			return t
+		}
+		if _, isStruct := decl.(*ast.StructType); isStruct {
+			return t
+		}
+		t = decl
+	}
+	return t
+}
+
+// empty returns the expression testing whether expr is empty, or "" if it never is.
+func (g *generator) empty(expr string, t ast.Expr) string {
+	switch t := g.underlying(t).(type) {
+	case *ast.Ident:
+		switch {
+		case t.Name == "string":
+			return expr + ` == ""`
+		case t.Name == "bool":
+			return "!" + expr
+		case signedTypes[t.Name] || unsignedTypes[t.Name] || t.Name == "float32" || t.Name == "float64":
+			return expr + " == 0"
+		case t.Name == "any", t.Name == "error":
+			return expr + " == nil"
+		case g.generated[t.Name]:
+			return ""
+		}
+	case *ast.StarExpr, *ast.InterfaceType, *ast.FuncType, *ast.ChanType:
+		return expr + " == nil"
+	case *ast.ArrayType, *ast.MapType:
+		return "len(" + expr + ") == 0"
+	}
+	return "dynjson.IsEmpty(" + expr + ")"
+}
+
+// value generates the code writing expr of type t, with the selection sel.
+func (g *generator) value(expr string, t ast.Expr, sel string, depth int) {
+	switch ut := g.underlying(t).(type) {
+	case *ast.Ident:
+		switch {
+		case g.generated[ut.Name]:
+			g.printf("if err := %s.ProjectJSON(w, %s); err != nil {\nreturn err\n}\n", expr, sel)
+			return
+		case ut.Name == "string":
+			g.printf("w.String(string(%s))\n", expr)
+			return
+		case ut.Name == "bool":
+			g.printf("w.Bool(bool(%s))\n", expr)
+			return
+		case signedTypes[ut.Name]:
+			g.printf("w.Int(int64(%s))\n", expr)
+			return
+		case unsignedTypes[ut.Name]:
+			g.printf("w.Uint(uint64(%s))\n", expr)
+			return
+		case ut.Name == "float32" || ut.Name == "float64":
+			g.printf("if err := w.Float(float64(%s), %s); err != nil {\nreturn err\n}\n", expr, ut.Name[5:])
+			return
+		}
+	case *ast.StarExpr:
+		g.printf("if %s == nil {\nw.Raw(\"null\")\n} else {\n", expr)
+		elem := "(*" + expr + ")"
+		if id, ok := ut.X.(*ast.Ident); ok && g.generated[id.Name] {
+			elem = expr
+		}
+		g.value(elem, ut.X, sel, depth)
+		g.printf("}\n")
+		return
+	case *ast.ArrayType:
+		if id, ok := g.underlying(ut.Elt).(*ast.Ident); ok && (id.Name == "byte" || id.Name == "uint8") && ut.Len == nil {
+			break
+		}
+		if ut.Len == nil && depth == 0 && g.isStruct(ut.Elt) {
+			// as with the formatter, nil slices of structs are empty when the fields are selected
+			g.printf("if %s == nil && all {\nw.Raw(\"null\")\n} else {\n", expr)
+		} else if ut.Len == nil {
+			g.printf("if %s == nil {\nw.Raw(\"null\")\n} else {\n", expr)
+		} else {
+			g.printf("{\n")
+		}
+		i, e := fmt.Sprintf("i%d", depth), fmt.Sprintf("e%d", depth)
+		g.printf("w.Byte('[')\n")
+		g.printf("for %s, %s := range %s {\n", i, e, expr)
+		g.printf("if %s > 0 {\nw.Byte(',')\n}\n", i)
+		g.value(e, ut.Elt, sel, depth+1)
+		g.printf("}\n")
+		g.printf("w.Byte(']')\n")
+		g.printf("}\n")
+		return
+	}
+	g.printf("if err := w.Project(%s, %s); err != nil {\nreturn err\n}\n", expr, sel)
+}
+
+// quotedValue generates the code writing expr of type t as a string, as the string option of json tags does.
+func (g *generator) quotedValue(expr string, t ast.Expr) {
+	if st, ok := g.underlying(t).(*ast.StarExpr); ok {
+		g.printf("if %s == nil {\nw.Raw(\"null\")\n} else {\n", expr)
+		g.quotedValue("(*"+expr+")", st.X)
+		g.printf("}\n")
+		return
+	}
+	// the value is written to a nested writer shadowing w
+	g.printf("{\nq := w\nw := &dynjson.JSONWriter{}\n")
+	g.value(expr, t, "nil", 0)
+	g.printf("q.String(string(w.Bytes()))\n}\n")
+}
+
+// isQuotable reports whether the string option of json tags applies to t: a basic type or a pointer to one.
+func (g *generator) isQuotable(t ast.Expr) bool {
+	if st, ok := g.underlying(t).(*ast.StarExpr); ok {
+		t = st.X
+	}
+	id, ok := g.underlying(t).(*ast.Ident)
+	return ok && (id.Name == "string" || id.Name == "bool" || signedTypes[id.Name] || unsignedTypes[id.Name] ||
+		id.Name == "float32" || id.Name == "float64")
+}
+
+// isImported reports whether t is a type of another package, or a pointer to one.
+func isImported(t ast.Expr) bool {
+	if st, ok := t.(*ast.StarExpr); ok {
+		t = st.X
+	}
+	_, ok := t.(*ast.SelectorExpr)
+	return ok
+}
+
+// isStruct reports whether t is a struct of the package, or a pointer to one.
+func (g *generator) isStruct(t ast.Expr) bool {
+	if st, ok := t.(*ast.StarExpr); ok {
+		t = st.X
+	}
+	switch t := t.(type) {
+	case *ast.StructType:
+		return true
+	case *ast.Ident:
+		_, ok := g.decls[t.Name].(*ast.StructType)
+		return ok
+	}
+	return false
+}
+
+// isLeaf reports whether t is made of basic types only, which have no subfields.
+func (g *generator) isLeaf(t ast.Expr) bool {
+	switch t := g.underlying(t).(type) {
+	case *ast.Ident:
+		return t.Name == "string" || t.Name == "bool" || signedTypes[t.Name] || unsignedTypes[t.Name] ||
+			t.Name == "float32" || t.Name == "float64"
+	case *ast.StarExpr:
+		return g.isLeaf(t.X)
+	case *ast.ArrayType:
+		return g.isLeaf(t.Elt)
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := generate("internal/example/example.go", []string{"Order", "Customer", "Item", "Option"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	expected, err := os.ReadFile("internal/example/example_dynjson.go")
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	if string(src) != string(expected) {
+		t.Error("Generated code differs from internal/example/example_dynjson.go, run go generate")
+	}
+}
+
+func TestGenerateUnknownType(t *testing.T) {
+	_, err := generate("internal/example/example.go", []string{"Unknown"})
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+}
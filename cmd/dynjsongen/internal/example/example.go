@@ -0,0 +1,56 @@
+// Package example holds the types used to test dynjsongen.
+package example
+
+import "time"
+
+//go:generate go run ../.. -type Order,Customer,Item,Option
+
+// Status is an order status.
+type Status string
+
+// Order is an order.
+type Order struct {
+	ID       int64     `json:"id"`
+	Status   Status    `json:"status,omitempty"`
+	Customer Customer  `json:"customer"`
+	Billing  *Customer `json:"billing,omitempty"`
+	Items    []Item    `json:"items"`
+	Tags     []string  `json:"tags,omitempty"`
+	Total    float64   `json:"total"`
+	Paid     bool      `json:"paid"`
+	Created  time.Time `json:"created"`
+	Notes    *string   `json:"notes,omitempty"`
+	Meta     Meta      `json:"meta"`
+	Secret   string    `json:"-"`
+	internal int
+}
+
+// Customer is a customer.
+type Customer struct {
+	ID    uint32 `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// Item is an order item.
+type Item struct {
+	SKU      string    `json:"sku"`
+	Quantity int       `json:"qty"`
+	Price    float32   `json:"price"`
+	Stock    int       `json:"stock,string"`
+	Options  []*Option `json:"options,omitempty"`
+	Raw      []byte    `json:"raw,omitempty"`
+}
+
+// Option is an item option.
+type Option struct {
+	Name  string  `json:"name"`
+	Price float32 `json:"price"`
+	Code  *string `json:"code,string"`
+}
+
+// Meta is not generated and is encoded with reflection.
+type Meta struct {
+	Source string `json:"source"`
+	Rank   int    `json:"rank"`
+}
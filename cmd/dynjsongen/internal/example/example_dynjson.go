@@ -0,0 +1,424 @@
+// Code generated by dynjsongen. DO NOT EDIT.
+
+package example
+
+import "github.com/cocoonspace/dynjson"
+
+var dynjsonSelectionOrder = dynjson.Selection{
+	{Name: "id"},
+	{Name: "status"},
+	{Name: "customer"},
+	{Name: "billing"},
+	{Name: "items"},
+	{Name: "tags"},
+	{Name: "total"},
+	{Name: "paid"},
+	{Name: "created"},
+	{Name: "notes"},
+	{Name: "meta"},
+}
+
+// ProjectJSON implements dynjson.Projector.
+func (v Order) ProjectJSON(w *dynjson.JSONWriter, sel dynjson.Selection) error {
+	all := len(sel) == 0
+	if all {
+		sel = dynjsonSelectionOrder
+	}
+	w.Byte('{')
+	n := 0
+	for _, f := range sel {
+		switch f.Name {
+		case "id":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("id." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"id":`)
+			w.Int(int64(v.ID))
+		case "status":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("status." + f.Fields.Paths()[0])
+			}
+			if v.Status == "" {
+				continue
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"status":`)
+			w.String(string(v.Status))
+		case "customer":
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"customer":`)
+			if err := v.Customer.ProjectJSON(w, f.Fields); err != nil {
+				return err
+			}
+		case "billing":
+			if v.Billing == nil {
+				continue
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"billing":`)
+			if v.Billing == nil {
+				w.Raw("null")
+			} else {
+				if err := v.Billing.ProjectJSON(w, f.Fields); err != nil {
+					return err
+				}
+			}
+		case "items":
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"items":`)
+			if v.Items == nil && all {
+				w.Raw("null")
+			} else {
+				w.Byte('[')
+				for i0, e0 := range v.Items {
+					if i0 > 0 {
+						w.Byte(',')
+					}
+					if err := e0.ProjectJSON(w, f.Fields); err != nil {
+						return err
+					}
+				}
+				w.Byte(']')
+			}
+		case "tags":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("tags." + f.Fields.Paths()[0])
+			}
+			if len(v.Tags) == 0 {
+				continue
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"tags":`)
+			if v.Tags == nil {
+				w.Raw("null")
+			} else {
+				w.Byte('[')
+				for i0, e0 := range v.Tags {
+					if i0 > 0 {
+						w.Byte(',')
+					}
+					w.String(string(e0))
+				}
+				w.Byte(']')
+			}
+		case "total":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("total." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"total":`)
+			if err := w.Float(float64(v.Total), 64); err != nil {
+				return err
+			}
+		case "paid":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("paid." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"paid":`)
+			w.Bool(bool(v.Paid))
+		case "created":
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"created":`)
+			if err := w.Project(v.Created, f.Fields); err != nil {
+				return err
+			}
+		case "notes":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("notes." + f.Fields.Paths()[0])
+			}
+			if v.Notes == nil {
+				continue
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"notes":`)
+			if v.Notes == nil {
+				w.Raw("null")
+			} else {
+				w.String(string((*v.Notes)))
+			}
+		case "meta":
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"meta":`)
+			if err := w.Project(v.Meta, f.Fields); err != nil {
+				return err
+			}
+		default:
+			return dynjson.UnknownField(f.Name)
+		}
+	}
+	w.Byte('}')
+	return nil
+}
+
+var dynjsonSelectionCustomer = dynjson.Selection{
+	{Name: "id"},
+	{Name: "name"},
+	{Name: "email"},
+}
+
+// ProjectJSON implements dynjson.Projector.
+func (v Customer) ProjectJSON(w *dynjson.JSONWriter, sel dynjson.Selection) error {
+	all := len(sel) == 0
+	if all {
+		sel = dynjsonSelectionCustomer
+	}
+	w.Byte('{')
+	n := 0
+	for _, f := range sel {
+		switch f.Name {
+		case "id":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("id." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"id":`)
+			w.Uint(uint64(v.ID))
+		case "name":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("name." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"name":`)
+			w.String(string(v.Name))
+		case "email":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("email." + f.Fields.Paths()[0])
+			}
+			if v.Email == "" {
+				continue
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"email":`)
+			w.String(string(v.Email))
+		default:
+			return dynjson.UnknownField(f.Name)
+		}
+	}
+	w.Byte('}')
+	return nil
+}
+
+var dynjsonSelectionItem = dynjson.Selection{
+	{Name: "sku"},
+	{Name: "qty"},
+	{Name: "price"},
+	{Name: "stock"},
+	{Name: "options"},
+	{Name: "raw"},
+}
+
+// ProjectJSON implements dynjson.Projector.
+func (v Item) ProjectJSON(w *dynjson.JSONWriter, sel dynjson.Selection) error {
+	all := len(sel) == 0
+	if all {
+		sel = dynjsonSelectionItem
+	}
+	w.Byte('{')
+	n := 0
+	for _, f := range sel {
+		switch f.Name {
+		case "sku":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("sku." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"sku":`)
+			w.String(string(v.SKU))
+		case "qty":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("qty." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"qty":`)
+			w.Int(int64(v.Quantity))
+		case "price":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("price." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"price":`)
+			if err := w.Float(float64(v.Price), 32); err != nil {
+				return err
+			}
+		case "stock":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("stock." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"stock":`)
+			{
+				q := w
+				w := &dynjson.JSONWriter{}
+				w.Int(int64(v.Stock))
+				q.String(string(w.Bytes()))
+			}
+		case "options":
+			if len(v.Options) == 0 {
+				continue
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"options":`)
+			if v.Options == nil && all {
+				w.Raw("null")
+			} else {
+				w.Byte('[')
+				for i0, e0 := range v.Options {
+					if i0 > 0 {
+						w.Byte(',')
+					}
+					if e0 == nil {
+						w.Raw("null")
+					} else {
+						if err := e0.ProjectJSON(w, f.Fields); err != nil {
+							return err
+						}
+					}
+				}
+				w.Byte(']')
+			}
+		case "raw":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("raw." + f.Fields.Paths()[0])
+			}
+			if len(v.Raw) == 0 {
+				continue
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"raw":`)
+			if err := w.Project(v.Raw, f.Fields); err != nil {
+				return err
+			}
+		default:
+			return dynjson.UnknownField(f.Name)
+		}
+	}
+	w.Byte('}')
+	return nil
+}
+
+var dynjsonSelectionOption = dynjson.Selection{
+	{Name: "name"},
+	{Name: "price"},
+	{Name: "code"},
+}
+
+// ProjectJSON implements dynjson.Projector.
+func (v Option) ProjectJSON(w *dynjson.JSONWriter, sel dynjson.Selection) error {
+	all := len(sel) == 0
+	if all {
+		sel = dynjsonSelectionOption
+	}
+	w.Byte('{')
+	n := 0
+	for _, f := range sel {
+		switch f.Name {
+		case "name":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("name." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"name":`)
+			w.String(string(v.Name))
+		case "price":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("price." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"price":`)
+			if err := w.Float(float64(v.Price), 32); err != nil {
+				return err
+			}
+		case "code":
+			if len(f.Fields) > 0 {
+				return dynjson.UnknownField("code." + f.Fields.Paths()[0])
+			}
+			if n > 0 {
+				w.Byte(',')
+			}
+			n++
+			w.Raw(`"code":`)
+			if v.Code == nil {
+				w.Raw("null")
+			} else {
+				{
+					q := w
+					w := &dynjson.JSONWriter{}
+					w.String(string((*v.Code)))
+					q.String(string(w.Bytes()))
+				}
+			}
+		default:
+			return dynjson.UnknownField(f.Name)
+		}
+	}
+	w.Byte('}')
+	return nil
+}
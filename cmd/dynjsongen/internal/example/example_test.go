@@ -0,0 +1,107 @@
+package example
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cocoonspace/dynjson"
+)
+
+func sample() []Order {
+	code := `x"<y>`
+	notes := "fragile <glass> &  co"
+	return []Order{
+		{
+			ID:       1,
+			Status:   "paid",
+			Customer: Customer{ID: 2, Name: "Jane \"J\" Doe", Email: "jane@example.com"},
+			Billing:  &Customer{ID: 3, Name: "ACME"},
+			Items: []Item{
+				{SKU: "a", Quantity: 2, Price: 1.1, Stock: 3, Options: []*Option{{Name: "b", Price: 1e-7, Code: &code}, {Name: "d"}, nil}},
+				{SKU: "c", Raw: []byte("raw")},
+			},
+			Tags:    []string{"x", "y"},
+			Total:   12.5,
+			Paid:    true,
+			Created: time.Date(2021, 10, 11, 12, 0, 0, 0, time.UTC),
+			Notes:   &notes,
+			Meta:    Meta{Source: "web", Rank: 1},
+		},
+		{
+			ID:    4,
+			Total: 1e21,
+		},
+	}
+}
+
+func TestProjectJSON(t *testing.T) {
+	var selections = []string{
+		"id",
+		"status,id",
+		"customer",
+		"customer.name,customer.email",
+		"billing.name",
+		"items",
+		"items.sku,items.options.price,total",
+		"tags,paid,created,notes",
+		"meta.rank",
+		"meta,items.raw",
+		"items.stock,items.options.code",
+	}
+	generated := dynjson.NewFormatter()
+	reflective := dynjson.NewFormatter(dynjson.WithObjects())
+	for _, selection := range selections {
+		fields := strings.Split(selection, ",")
+		for _, src := range []interface{}{sample()[0], &sample()[1], sample(), []Order(nil)} {
+			expected, err := reflective.Format(src, fields)
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			o, err := generated.Format(src, fields)
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			expectedBuf, err := json.Marshal(expected)
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			buf, err := json.Marshal(o)
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			if string(buf) != string(expectedBuf) {
+				t.Errorf("%s: returned '%s', expected '%s'", selection, string(buf), string(expectedBuf))
+			}
+		}
+	}
+}
+
+func TestProjectJSONAll(t *testing.T) {
+	for _, o := range sample() {
+		var w dynjson.JSONWriter
+		err := o.ProjectJSON(&w, nil)
+		if err != nil {
+			t.Fatal("Should not have returned", err)
+		}
+		expected, err := json.Marshal(o)
+		if err != nil {
+			t.Fatal("Should not have returned", err)
+		}
+		if string(w.Bytes()) != string(expected) {
+			t.Errorf("Returned '%s', expected '%s'", string(w.Bytes()), string(expected))
+		}
+	}
+}
+
+func TestProjectJSONUnknownField(t *testing.T) {
+	var w dynjson.JSONWriter
+	err := sample()[0].ProjectJSON(&w, dynjson.ParseSelection([]string{"id.foo"}))
+	if err == nil {
+		t.Fatal("Expected error but returned nil")
+	}
+	if err.Error() != "field 'id.foo' does not exist" {
+		t.Errorf("Returned '%s', expected '%s'", err.Error(), "field 'id.foo' does not exist")
+	}
+}
@@ -0,0 +1,57 @@
+// Command dynjsongen generates reflection-free ProjectJSON methods for dynjson.
+//
+// It is meant to be used with go:generate:
+//
+//	//go:generate go run github.com/cocoonspace/dynjson/cmd/dynjsongen -type Foo,Bar
+//
+// For each struct type of the file (or only the ones listed with -type), it generates
+// a ProjectJSON method implementing dynjson.Projector in a <file>_dynjson.go file.
+//
+// Fields of basic types, pointers, slices and arrays, and structs generated by dynjsongen
+// are encoded without reflection. Other fields are encoded with encoding/json.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dynjsongen: ")
+	types := flag.String("type", "", "comma separated list of struct types (default: all structs of the file)")
+	output := flag.String("output", "", "output file name (default: <file>_dynjson.go)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: dynjsongen [flags] [file.go]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	file := os.Getenv("GOFILE")
+	if flag.NArg() > 0 {
+		file = flag.Arg(0)
+	}
+	if file == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var names []string
+	if *types != "" {
+		names = strings.Split(*types, ",")
+	}
+	src, err := generate(file, names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(file, ".go") + "_dynjson.go"
+	}
+	err = os.WriteFile(filepath.Clean(*output), src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,314 @@
+package dynjson
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// SliceMode defines how CSV encoders write the fields of nested slices.
+type SliceMode int
+
+const (
+	// SliceJoin writes the values of all the elements in a single cell, joined by a separator.
+	SliceJoin SliceMode = iota
+	// SliceExplode writes one row per element.
+	SliceExplode
+)
+
+// CSVEncoder writes the selected fields of structs, or slices of structs, as CSV rows.
+//
+// The selected fields are the columns, in selection order, nested struct fields being
+// flattened with dotted headers (e.g. customer.name).
+type CSVEncoder struct {
+	f      *Formatter
+	w      *csv.Writer
+	mode   SliceMode
+	sep    string
+	header bool
+}
+
+// NewCSVEncoder returns a new encoder writing comma separated values to w, using f (or a new formatter if nil).
+func NewCSVEncoder(w io.Writer, f *Formatter) *CSVEncoder {
+	if f == nil {
+		f = NewFormatter()
+	}
+	return &CSVEncoder{f: f, w: csv.NewWriter(f.limitedWriter(w)), mode: SliceJoin, sep: ",", header: true}
+}
+
+// NewTSVEncoder returns a new encoder writing tab separated values to w, using f (or a new formatter if nil).
+func NewTSVEncoder(w io.Writer, f *Formatter) *CSVEncoder {
+	e := NewCSVEncoder(w, f)
+	e.w.Comma = '\t'
+	return e
+}
+
+// SetSliceMode sets how nested slices are written, sep being the separator used by SliceJoin.
+func (e *CSVEncoder) SetSliceMode(mode SliceMode, sep string) {
+	e.mode = mode
+	e.sep = sep
+}
+
+// SetHeader sets whether a header row is written before the values (true by default).
+func (e *CSVEncoder) SetHeader(header bool) {
+	e.header = header
+}
+
+// Encode writes the selected fields of o (or all of them if none specified), one row per slice element.
+func (e *CSVEncoder) Encode(o interface{}, fields []string) error {
+	return e.EncodeContext(context.Background(), o, fields)
+}
+
+// EncodeContext is like Encode, the context being available to all the formatting stages.
+func (e *CSVEncoder) EncodeContext(ctx context.Context, o interface{}, fields []string) error {
+	if o == nil {
+		// nil values have no type, hence no columns nor rows
+		return nil
+	}
+	t := reflect.TypeOf(o)
+	single := t.Kind() != reflect.Slice || !isStructOrStructPointer(t.Elem())
+	if !single {
+		t = t.Elem()
+	}
+	fo, err := e.f.FormatContext(ctx, o, fields)
+	if err != nil {
+		return err
+	}
+	b, err := e.f.builder(t)
+	if err != nil {
+		return err
+	}
+	// unknown fields ignored in lenient mode, and unauthorized ones, get no column
+	selected, err := e.f.selectedFields(ctx, reflect.TypeOf(o), fields)
+	if err != nil {
+		return err
+	}
+	var columns []string
+	if len(selected) > 0 {
+		columns = expandFields(b, selected)
+	} else if len(fields) == 0 {
+		columns = expandFields(b, nil)
+	}
+	records, err := jsonRecords(fo, single)
+	if err != nil {
+		return err
+	}
+	if e.header {
+		err = e.w.Write(columns)
+		if err != nil {
+			return err
+		}
+	}
+	paths := make([][]string, len(columns))
+	for i, col := range columns {
+		paths[i] = strings.Split(col, ".")
+	}
+	for _, record := range records {
+		if e.mode == SliceExplode {
+			err = e.writeExploded(record, paths)
+		} else {
+			err = e.writeRow(record, paths)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *CSVEncoder) writeRow(record interface{}, paths [][]string) error {
+	row := make([]string, len(paths))
+	for i, path := range paths {
+		var cells []string
+		for _, v := range lookup(record, path) {
+			cells = append(cells, cellValues(v)...)
+		}
+		row[i] = strings.Join(cells, e.sep)
+	}
+	return e.w.Write(row)
+}
+
+// writeExploded writes one row per combination of the elements of the nested slices of record.
+func (e *CSVEncoder) writeExploded(record interface{}, paths [][]string) error {
+	for _, path := range paths {
+		v := record
+		for i, seg := range path[:len(path)-1] {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				break
+			}
+			v = m[seg]
+			elems, ok := v.([]interface{})
+			if !ok {
+				continue
+			}
+			if len(elems) == 0 {
+				elems = []interface{}{nil}
+			}
+			for _, elem := range elems {
+				err := e.writeExploded(replace(record, path[:i+1], elem), paths)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return e.writeRow(record, paths)
+}
+
+// expandFields returns the selected fields, structs being expanded into all their fields.
+func expandFields(b builder, fields []string) []string {
+	if len(fields) == 0 {
+		return leaves(b, "")
+	}
+	var columns []string
+	seen := map[string]bool{}
+	for _, field := range fields {
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		fb := b
+		for _, seg := range strings.Split(field, ".") {
+			if sb := structOf(fb); sb != nil {
+				fb = sb.builders[seg]
+			}
+		}
+		if structOf(fb) != nil {
+			columns = append(columns, leaves(fb, field+".")...)
+		} else {
+			columns = append(columns, field)
+		}
+	}
+	return columns
+}
+
+// leaves returns all the non struct fields under b, in declaration order.
+func leaves(b builder, prefix string) []string {
+	sb := structOf(b)
+	var paths []string
+	for _, name := range sb.names {
+		if structOf(sb.builders[name]) != nil {
+			paths = append(paths, leaves(sb.builders[name], prefix+name+".")...)
+		} else {
+			paths = append(paths, prefix+name)
+		}
+	}
+	return paths
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// structOf returns the struct builder of b, a struct builder or a pointer or slice builder of structs,
+// unless the struct has its own marshaling or no fields.
+func structOf(b builder) *structBuilder {
+	switch b := b.(type) {
+	case *structBuilder:
+		pt := reflect.PtrTo(b.t)
+		if len(b.names) == 0 || pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType) {
+			return nil
+		}
+		return b
+	case *pointerBuilder:
+		return structOf(b.elem)
+	case *sliceBuilder:
+		return structOf(b.elem)
+	}
+	return nil
+}
+
+// jsonRecords returns the JSON representation of the formatted value o, as a list of records.
+func jsonRecords(o interface{}, single bool) ([]interface{}, error) {
+	buf, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var v interface{}
+	err = dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	if single {
+		return []interface{}{v}, nil
+	}
+	records, _ := v.([]interface{})
+	return records, nil
+}
+
+// lookup returns the values found at path in v, traversing arrays.
+func lookup(v interface{}, path []string) []interface{} {
+	if elems, ok := v.([]interface{}); ok && len(path) > 0 {
+		var vals []interface{}
+		for _, elem := range elems {
+			vals = append(vals, lookup(elem, path)...)
+		}
+		return vals
+	}
+	if len(path) == 0 {
+		return []interface{}{v}
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	fv, found := m[path[0]]
+	if !found {
+		return nil
+	}
+	return lookup(fv, path[1:])
+}
+
+// replace returns a copy of the record v where the value at path is replaced by val.
+func replace(v interface{}, path []string, val interface{}) interface{} {
+	if len(path) == 0 {
+		return val
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	cp := make(map[string]interface{}, len(m))
+	for k, mv := range m {
+		cp[k] = mv
+	}
+	cp[path[0]] = replace(m[path[0]], path[1:], val)
+	return cp
+}
+
+// cellValues returns the CSV representation of a JSON value, one per array element.
+func cellValues(v interface{}) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case json.Number:
+		return []string{v.String()}
+	case bool:
+		if v {
+			return []string{"true"}
+		}
+		return []string{"false"}
+	case []interface{}:
+		var vals []string
+		for _, elem := range v {
+			vals = append(vals, cellValues(elem)...)
+		}
+		return vals
+	default:
+		buf, _ := json.Marshal(v)
+		return []string{string(buf)}
+	}
+}
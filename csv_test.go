@@ -0,0 +1,120 @@
+package dynjson
+
+import (
+	"bytes"
+	"testing"
+)
+
+type csvCustomer struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type csvItem struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"qty"`
+}
+
+type csvOrder struct {
+	ID       int          `json:"id"`
+	Customer csvCustomer  `json:"customer"`
+	Billing  *csvCustomer `json:"billing"`
+	Items    []csvItem    `json:"items"`
+	Tags     []string     `json:"tags"`
+	Total    float64      `json:"total"`
+}
+
+func csvOrders() []csvOrder {
+	return []csvOrder{
+		{
+			ID:       1,
+			Customer: csvCustomer{ID: 10, Name: "Doe, Jane"},
+			Items:    []csvItem{{SKU: "a", Quantity: 1}, {SKU: "b", Quantity: 2}},
+			Tags:     []string{"x", "y"},
+			Total:    12.5,
+		},
+		{
+			ID:       2,
+			Customer: csvCustomer{ID: 11, Name: "Smith"},
+			Billing:  &csvCustomer{ID: 12, Name: "ACME"},
+			Total:    3,
+		},
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	var tests = []struct {
+		src    interface{}
+		fields []string
+		mode   SliceMode
+		tsv    bool
+		output string
+	}{
+		{
+			src:    csvOrders(),
+			fields: []string{"id", "customer.name", "total"},
+			output: "id,customer.name,total\n1,\"Doe, Jane\",12.5\n2,Smith,3\n",
+		},
+		{
+			src:    csvOrders()[0],
+			fields: []string{"total", "customer"},
+			output: "total,customer.id,customer.name\n12.5,10,\"Doe, Jane\"\n",
+		},
+		{
+			src:    csvOrders(),
+			fields: []string{"id", "billing.name", "items.sku", "tags"},
+			output: "id,billing.name,items.sku,tags\n1,,a|b,x|y\n2,ACME,,\n",
+		},
+		{
+			src:    csvOrders(),
+			fields: []string{"id", "items"},
+			mode:   SliceExplode,
+			output: "id,items.sku,items.qty\n1,a,1\n1,b,2\n2,,\n",
+		},
+		{
+			src:    csvOrders()[1:],
+			fields: nil,
+			tsv:    true,
+			output: "id\tcustomer.id\tcustomer.name\tbilling.id\tbilling.name\titems.sku\titems.qty\ttags\ttotal\n2\t11\tSmith\t12\tACME\t\t\t\t3\n",
+		},
+		{
+			src:    nil,
+			fields: []string{"id"},
+			output: "",
+		},
+	}
+	for _, tt := range tests {
+		var w bytes.Buffer
+		e := NewCSVEncoder(&w, nil)
+		if tt.tsv {
+			e = NewTSVEncoder(&w, nil)
+		}
+		e.SetSliceMode(tt.mode, "|")
+		err := e.Encode(tt.src, tt.fields)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if w.String() != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", w.String(), tt.output)
+		}
+	}
+}
+
+func TestCSVEncoderError(t *testing.T) {
+	var w bytes.Buffer
+	err := NewCSVEncoder(&w, NewFormatter()).Encode(csvOrders(), []string{"foo"})
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+}
+
+func TestCSVEncoderLenient(t *testing.T) {
+	var w bytes.Buffer
+	err := NewCSVEncoder(&w, NewFormatter(WithLenient())).Encode(csvOrders(), []string{"id", "foo", "customer.bar"})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if w.String() != "id\n1\n2\n" {
+		t.Errorf("Returned '%s', expected '%s'", w.String(), "id\n1\n2\n")
+	}
+}
@@ -0,0 +1,229 @@
+package dynjson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownFieldError is returned when a selected field does not exist.
+type UnknownFieldError struct {
+	// Path is the dot separated path of the field.
+	Path string
+	// Available are the names of the fields of the parent struct, in declaration order.
+	Available []string
+	// Suggestions are the available fields with a name close to the unknown one.
+	Suggestions []string
+}
+
+func (e *UnknownFieldError) Error() string {
+	msg := "field '" + e.Path + "' does not exist"
+	if len(e.Suggestions) > 0 {
+		msg += ", did you mean '" + strings.Join(e.Suggestions, "' or '") + "'?"
+	}
+	return msg
+}
+
+// DuplicateFieldError is returned when fields are selected more than once.
+type DuplicateFieldError struct {
+	// Paths are the dot separated paths of the duplicate fields, sorted.
+	Paths []string
+}
+
+func (e *DuplicateFieldError) Error() string {
+	return "duplicate fields detected: " + strings.Join(e.Paths, ", ")
+}
+
+// UnsupportedTypeError is returned when a selected field cannot be encoded in JSON.
+type UnsupportedTypeError struct {
+	// Path is the dot separated path of the field.
+	Path string
+	// Type is the type of the field.
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "field '" + e.Path + "' has unsupported type " + e.Type.String()
+}
+
+// MaskerError is returned for types with fields tagged with an unknown masker (see WithMasker).
+// It is a configuration error of the formatter, not of the selection.
+type MaskerError struct {
+	// Type is the struct type holding the field.
+	Type reflect.Type
+	// Field is the name of the field.
+	Field string
+	// Masker is the name of the unknown masker.
+	Masker string
+}
+
+func (e *MaskerError) Error() string {
+	return "field '" + e.Field + "' of " + e.Type.String() + " has unknown masker '" + e.Masker + "'"
+}
+
+// LimitError is returned when a selection exceeds the limits of the formatter (see WithLimits).
+type LimitError struct {
+	// Limit is the exceeded limit: fields, depth or length.
+	Limit string
+	// Max is the value of the limit.
+	Max int
+	// Value is the value of the selection.
+	Value int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("selection %s (%d) exceeds the limit (%d)", e.Limit, e.Value, e.Max)
+}
+
+// check returns a LimitError if fields exceed the limits.
+func (l Limits) check(fields []string) error {
+	if l.MaxFields > 0 && len(fields) > l.MaxFields {
+		return &LimitError{Limit: "fields", Max: l.MaxFields, Value: len(fields)}
+	}
+	length, depth := 0, 0
+	for i, field := range fields {
+		if i > 0 {
+			length++
+		}
+		length += len(field)
+		if d := strings.Count(field, ".") + 1; d > depth {
+			depth = d
+		}
+	}
+	if l.MaxLength > 0 && length > l.MaxLength {
+		return &LimitError{Limit: "length", Max: l.MaxLength, Value: length}
+	}
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return &LimitError{Limit: "depth", Max: l.MaxDepth, Value: depth}
+	}
+	return nil
+}
+
+// SelectionError is returned when a selection has several problems.
+//
+// When there is a single problem, its error is returned directly.
+type SelectionError struct {
+	Errors []error
+}
+
+func (e *SelectionError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors, for errors.Is and errors.As from Go 1.20.
+func (e *SelectionError) Unwrap() []error {
+	return e.Errors
+}
+
+// Is reports whether one of the errors matches target, for errors.Is before Go 1.20.
+func (e *SelectionError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors matching target, for errors.As before Go 1.20.
+func (e *SelectionError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendError appends err to errs, flattening selection errors.
+func appendError(errs []error, err error) []error {
+	if se, ok := err.(*SelectionError); ok {
+		return append(errs, se.Errors...)
+	}
+	return append(errs, err)
+}
+
+// joinErrors returns nil, the single error of errs, or a SelectionError.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &SelectionError{Errors: errs}
+}
+
+// maxSuggestions is the maximum number of suggestions of unknown field errors.
+const maxSuggestions = 3
+
+// suggest returns the names close to name, closest first.
+func suggest(name string, names []string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	max := len(name) / 3
+	if max < 1 {
+		max = 1
+	}
+	for _, n := range names {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(n)); d <= max {
+			candidates = append(candidates, candidate{name: n, distance: d})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+	var suggestions []string
+	for _, c := range candidates {
+		suggestions = append(suggestions, c.name)
+	}
+	return suggestions
+}
+
+// editDistance returns the optimal string alignment distance between a and b,
+// that is the Levenshtein distance with transpositions of adjacent characters.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a int, b ...int) int {
+	for _, v := range b {
+		if v < a {
+			a = v
+		}
+	}
+	return a
+}
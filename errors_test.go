@@ -0,0 +1,142 @@
+package dynjson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type errorsItem struct {
+	Name     string         `json:"name"`
+	Quantity int            `json:"quantity"`
+	Callback func()         `json:"callback"`
+	Values   chan int       `json:"values"`
+	Sub      *errorsSubItem `json:"sub"`
+}
+
+type errorsSubItem struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+func TestUnknownFieldError(t *testing.T) {
+	_, err := NewFormatter().Format(errorsItem{}, []string{"nmae"})
+	ufe, ok := err.(*UnknownFieldError)
+	if !ok {
+		t.Fatalf("Returned '%v', expected an UnknownFieldError", err)
+	}
+	if ufe.Path != "nmae" {
+		t.Errorf("Returned '%s', expected '%s'", ufe.Path, "nmae")
+	}
+	available := []string{"name", "quantity", "callback", "values", "sub"}
+	if !reflect.DeepEqual(ufe.Available, available) {
+		t.Errorf("Returned %v, expected %v", ufe.Available, available)
+	}
+	msg := "field 'nmae' does not exist, did you mean 'name'?"
+	if err.Error() != msg {
+		t.Errorf("Returned '%s', expected '%s'", err.Error(), msg)
+	}
+}
+
+func TestSelectionError(t *testing.T) {
+	_, err := NewFormatter(WithObjects()).Format(errorsItem{}, []string{"Name", "name", "name", "callback", "sub.quantty", "sub.quantty", "sub.name.first", "values"})
+	se, ok := err.(*SelectionError)
+	if !ok {
+		t.Fatalf("Returned '%v', expected a SelectionError", err)
+	}
+	expected := []string{
+		"duplicate fields detected: name, sub.quantty",
+		"field 'Name' does not exist, did you mean 'name'?",
+		"field 'callback' has unsupported type func()",
+		"field 'sub.quantty' does not exist, did you mean 'quantity'?",
+		"field 'sub.name.first' does not exist",
+		"field 'values' has unsupported type chan int",
+	}
+	var msgs []string
+	for _, err := range se.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	if !reflect.DeepEqual(msgs, expected) {
+		t.Errorf("Returned %q, expected %q", msgs, expected)
+	}
+	if err.Error() != strings.Join(expected, "; ") {
+		t.Errorf("Returned '%s', expected '%s'", err.Error(), strings.Join(expected, "; "))
+	}
+	if _, ok := se.Errors[0].(*DuplicateFieldError); !ok {
+		t.Errorf("Returned '%v', expected a DuplicateFieldError", se.Errors[0])
+	}
+	if ute, ok := se.Errors[2].(*UnsupportedTypeError); !ok || ute.Type != reflect.TypeOf(func() {}) {
+		t.Errorf("Returned '%v', expected an UnsupportedTypeError", se.Errors[2])
+	}
+	wrapped := fmt.Errorf("select: %w", err)
+	var ufe *UnknownFieldError
+	if !errors.As(wrapped, &ufe) || ufe.Path != "Name" {
+		t.Errorf("Returned '%v', expected the UnknownFieldError of 'Name'", ufe)
+	}
+	var fe *ForbiddenFieldError
+	if errors.As(wrapped, &fe) {
+		t.Errorf("Returned '%v', expected no ForbiddenFieldError", fe)
+	}
+	if !errors.Is(wrapped, se.Errors[2]) {
+		t.Error("Expected the UnsupportedTypeError to be found")
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	names := []string{"name", "names", "quantity", "id", "Type"}
+	var tests = []struct {
+		name        string
+		suggestions []string
+	}{
+		{name: "nam", suggestions: []string{"name"}},
+		{name: "nmaes", suggestions: []string{"names"}},
+		{name: "nams", suggestions: []string{"name", "names"}},
+		{name: "type", suggestions: []string{"Type"}},
+		{name: "ids", suggestions: []string{"id"}},
+		{name: "quanitty", suggestions: []string{"quantity"}},
+		{name: "foo"},
+	}
+	for _, tt := range tests {
+		suggestions := suggest(tt.name, names)
+		if !reflect.DeepEqual(suggestions, tt.suggestions) {
+			t.Errorf("%s: returned %v, expected %v", tt.name, suggestions, tt.suggestions)
+		}
+	}
+}
+
+func TestLimitError(t *testing.T) {
+	f := NewFormatter(WithLimits(Limits{MaxFields: 3, MaxDepth: 2, MaxLength: 20}))
+	var tests = []struct {
+		fields []string
+		err    string
+	}{
+		{fields: []string{"name", "sub.name"}},
+		{fields: []string{"name", "sub.name", "quantity", "values"}, err: "selection fields (4) exceeds the limit (3)"},
+		{fields: []string{"sub.name.first"}, err: "selection depth (3) exceeds the limit (2)"},
+		{fields: []string{"sub.name", "sub.quantity"}, err: "selection length (21) exceeds the limit (20)"},
+		{fields: []string{"name", "sub"}},
+		{fields: []string{"name", "quantity", "sub"}, err: "selection fields (4) exceeds the limit (3)"},
+		{},
+	}
+	for _, tt := range tests {
+		_, err := f.Format(errorsItem{}, tt.fields)
+		if tt.err == "" {
+			if err != nil {
+				t.Error("Should not have returned", err)
+			}
+			continue
+		}
+		if _, ok := err.(*LimitError); !ok {
+			t.Errorf("Returned '%v', expected a LimitError", err)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("Returned '%s', expected '%s'", err.Error(), tt.err)
+		}
+	}
+	if len(f.compiled[reflect.TypeOf(errorsItem{})]) != 2 {
+		t.Errorf("Returned %d compilations, expected 2", len(f.compiled[reflect.TypeOf(errorsItem{})]))
+	}
+}
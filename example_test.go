@@ -26,3 +26,22 @@ func ExampleFormatter_Format() {
 		// handle error
 	}
 }
+
+func ExampleCompile() {
+	var w http.ResponseWriter
+	var r *http.Request
+
+	type APIResult struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}
+
+	p, err := Compile[APIResult](FieldsFromRequest(r))
+	if err != nil {
+		// handle error
+	}
+	err = p.Encode(w, APIResult{Foo: 1, Bar: "bar"}) // {"foo": 1}
+	if err != nil {
+		// handle error
+	}
+}
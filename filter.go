@@ -0,0 +1,107 @@
+package dynjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// FilterJSON returns the selected fields of the JSON document data (or data itself if none specified),
+// without knowing its Go type.
+//
+// Selected fields are written in selection order, the selection being applied to all the elements of arrays.
+// Selected fields missing from the document are skipped, and subfields of non-object values are ignored.
+func FilterJSON(data []byte, fields []string) ([]byte, error) {
+	if len(fields) == 0 {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	err := filterJSON(&buf, data, ParseSelection(fields))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasSuffix(data, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func filterJSON(buf *bytes.Buffer, data json.RawMessage, sel Selection) error {
+	data = bytes.TrimSpace(data)
+	if len(sel) == 0 || len(data) == 0 || (data[0] != '{' && data[0] != '[') {
+		return json.Compact(buf, data)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	_, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if data[0] == '[' {
+		buf.WriteByte('[')
+		for i := 0; dec.More(); i++ {
+			var elem json.RawMessage
+			err = dec.Decode(&elem)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			err = filterJSON(buf, elem, sel)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return checkEnd(dec, data)
+	}
+	members := map[string]json.RawMessage{}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var val json.RawMessage
+		err = dec.Decode(&val)
+		if err != nil {
+			return err
+		}
+		members[key.(string)] = val
+	}
+	buf.WriteByte('{')
+	first := true
+	for _, f := range sel {
+		val, ok := members[f.Name]
+		if !ok {
+			continue
+		}
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		key, err := json.Marshal(f.Name)
+		if err != nil {
+			return err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		err = filterJSON(buf, val, f.Fields)
+		if err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return checkEnd(dec, data)
+}
+
+// checkEnd checks that the closing delimiter of data ends it.
+func checkEnd(dec *json.Decoder, data []byte) error {
+	_, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if dec.InputOffset() != int64(len(data)) {
+		return fmt.Errorf("invalid character after top-level value at offset %d", dec.InputOffset())
+	}
+	return nil
+}
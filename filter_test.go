@@ -0,0 +1,37 @@
+package dynjson
+
+import "testing"
+
+func TestFilterJSON(t *testing.T) {
+	var tests = []struct {
+		data   string
+		fields []string
+		output string
+	}{
+		{data: `{"foo":1,"bar":2}`, output: `{"foo":1,"bar":2}`},
+		{data: `{"foo":1,"bar":2}`, fields: []string{"bar", "foo"}, output: `{"bar":2,"foo":1}`},
+		{data: `{"foo":1,"bar":2}` + "\n", fields: []string{"foo", "baz"}, output: `{"foo":1}` + "\n"},
+		{data: ` [ {"foo": 1, "bar": 2}, {"bar": 3} ] `, fields: []string{"bar"}, output: `[{"bar":2},{"bar":3}]`},
+		{data: `{"foo":{"a": [1, 2],"b":2},"bar":null}`, fields: []string{"foo"}, output: `{"foo":{"a":[1,2],"b":2}}`},
+		{data: `{"foo":[{"a":1,"b":2}],"bar":null}`, fields: []string{"foo.b", "bar.a"}, output: `{"foo":[{"b":2}],"bar":null}`},
+		{data: `"foo"`, fields: []string{"foo"}, output: `"foo"`},
+	}
+	for _, tt := range tests {
+		output, err := FilterJSON([]byte(tt.data), tt.fields)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if string(output) != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", string(output), tt.output)
+		}
+	}
+}
+
+func TestFilterJSONError(t *testing.T) {
+	for _, data := range []string{`{"foo":`, `[1,}`, `{"foo":1}}`} {
+		_, err := FilterJSON([]byte(data), []string{"foo"})
+		if err == nil {
+			t.Errorf("%s: expected error but returned nil", data)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package dynjson
 
 import (
+	"context"
+	"encoding/json"
+	"io"
 	"reflect"
 	"strings"
 	"sync"
@@ -8,56 +11,363 @@ import (
 
 type formatter interface {
 	typ() reflect.Type
-	format(src reflect.Value) (reflect.Value, error)
+	format(ctx context.Context, src reflect.Value) (reflect.Value, error)
 }
 
 // Formatter is a dynamic API format formatter.
 type Formatter struct {
 	mu         sync.Mutex
 	builders   map[reflect.Type]builder
-	formatters map[reflect.Type]map[string]formatter
+	compiled   map[reflect.Type]map[compiledKey]*compiled
+	objects    bool
+	lenient    bool
+	limits     Limits
+	costs      map[reflect.Type]map[string]int
+	sliceMul   int
+	budget     int
+	authorizer Authorizer
+	authPolicy AuthorizerPolicy
+	output     OutputLimits
+	truncate   bool
+	policy     *Policy
+	maskers    map[string]Masker
+	audit      func(ctx context.Context, e AuditEvent)
+	idField    string
+	// sensitive tells whether types have masked (or audited) fields.
+	sensitive map[reflect.Type]bool
+	pool      *workerPool
 }
 
 // NewFormatter creates a new formatter.
-func NewFormatter() *Formatter {
-	return &Formatter{
-		builders:   map[reflect.Type]builder{},
-		formatters: map[reflect.Type]map[string]formatter{},
+func NewFormatter(opts ...FormatterOption) *Formatter {
+	f := &Formatter{
+		builders:  map[reflect.Type]builder{},
+		costs:     map[reflect.Type]map[string]int{},
+		sliceMul:  1,
+		compiled:  map[reflect.Type]map[compiledKey]*compiled{},
+		maskers:   map[string]Masker{},
+		sensitive: map[reflect.Type]bool{},
 	}
+	for name, m := range defaultMaskers {
+		f.maskers[name] = m
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 // Format formats either a struct or a slice, returning only the selected fields (or all if none specified).
-func (f *Formatter) Format(o interface{}, fields []string) (interface{}, error) {
-	if len(fields) == 0 {
+func (f *Formatter) Format(o interface{}, fields []string, opts ...FormatOption) (interface{}, error) {
+	return f.FormatContext(context.Background(), o, fields, opts...)
+}
+
+// FormatContext is like Format, the context being available to all the formatting stages.
+// Formatting slices is stopped, returning the context error, when ctx is done.
+func (f *Formatter) FormatContext(ctx context.Context, o interface{}, fields []string, opts ...FormatOption) (interface{}, error) {
+	var fo formatOptions
+	for _, opt := range opts {
+		opt(&fo)
+	}
+	// reports tell the cost of the default selection as well
+	if !f.selects(o, fields) && (o == nil || fo.report == nil) {
 		return o, nil
 	}
 	v := reflect.ValueOf(o)
-	t := v.Type()
+	c, err := f.compileMode(ctx, v.Type(), fields, f.lenient || fo.lenient)
+	if err != nil {
+		return nil, err
+	}
+	if fo.report != nil {
+		fo.report.Ignored = append(fo.report.Ignored, c.ignored...)
+		fo.report.Denied = append(fo.report.Denied, c.denied...)
+		fo.report.Cost += c.cost
+	}
+	ctx, out := f.outputContext(ctx)
+	r, err := formatValue(ctx, c.json(), v)
+	if err != nil {
+		return nil, err
+	}
+	if fo.report != nil && out.wasTruncated() {
+		fo.report.Truncated = true
+	}
+	f.auditValue(ctx, c.pii, fields, emitted(v, r))
+	return r, nil
+}
+
+// formatReflect is like FormatContext, without relying on ProjectJSON methods.
+func (f *Formatter) formatReflect(ctx context.Context, o interface{}, fields []string) (interface{}, error) {
+	if !f.selects(o, fields) {
+		return o, nil
+	}
+	v := reflect.ValueOf(o)
+	c, err := f.compile(ctx, v.Type(), fields)
+	if err != nil {
+		return nil, err
+	}
+	ctx, _ = f.outputContext(ctx)
+	r, err := formatValue(ctx, c.formatter, v)
+	if err != nil {
+		return nil, err
+	}
+	f.auditValue(ctx, c.pii, fields, emitted(v, r))
+	return r, nil
+}
+
+// selects reports whether formatting o needs a compilation: with a selection, or to drop unauthorized,
+// mask or audit fields.
+func (f *Formatter) selects(o interface{}, fields []string) bool {
+	return o != nil && (len(fields) > 0 || f.restricted(reflect.TypeOf(o)))
+}
+
+// restricted reports whether values of type t may have unauthorized, masked or audited fields,
+// or limited slices, or whether their cost is limited.
+func (f *Formatter) restricted(t reflect.Type) bool {
+	if f.authorizer != nil || f.output.limitsElements() || f.budget > 0 {
+		return true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.builderLocked(t); err != nil {
+		// reported when compiling
+		return true
+	}
+	return f.sensitive[t]
+}
+
+// Encode writes the JSON encoding of the selected fields of o to w.
+func (f *Formatter) Encode(w io.Writer, o interface{}, fields []string, opts ...FormatOption) error {
+	return f.EncodeContext(context.Background(), w, o, fields, opts...)
+}
+
+// EncodeContext is like Encode, the context being available to all the formatting stages.
+func (f *Formatter) EncodeContext(ctx context.Context, w io.Writer, o interface{}, fields []string, opts ...FormatOption) error {
+	o, err := f.FormatContext(ctx, o, fields, opts...)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(f.limitedWriter(w)).Encode(o)
+}
+
+// compiled is a selection compiled for a type.
+type compiled struct {
+	// formatter is the reflection based formatter.
+	formatter formatter
+	// projector relies on ProjectJSON methods, if available.
+	projector formatter
+	// fields are the selected fields, without the ignored ones.
+	fields []string
+	// ignored are the unknown paths dropped in lenient mode.
+	ignored []string
+	// denied are the unauthorized paths dropped.
+	denied []string
+	// cost is the cost of the selected fields.
+	cost int
+	// count is the number of leaf fields selected, once expanded.
+	count int
+	// pii are the paths of the unmasked pii fields selected.
+	pii []string
+}
+
+// compiledKey identifies a compilation of a type.
+type compiledKey struct {
+	fields  string
+	lenient bool
+	profile string
+}
+
+// json returns the preferred formatter for JSON output.
+func (c *compiled) json() formatter {
+	if c.projector != nil {
+		return c.projector
+	}
+	return c.formatter
+}
+
+// compile returns the cached compilation of the given fields for type t, compiling them if needed,
+// ctx giving the authorization profile.
+func (f *Formatter) compile(ctx context.Context, t reflect.Type, fields []string) (*compiled, error) {
+	return f.compileMode(ctx, t, fields, f.lenient)
+}
+
+// compileMode is like compile, unknown fields being ignored if lenient.
+func (f *Formatter) compileMode(ctx context.Context, t reflect.Type, fields []string, lenient bool) (*compiled, error) {
+	return f.compileBudget(ctx, t, fields, lenient, f.budget)
+}
+
+// Cost returns the cost of the selected fields of o (see WithFieldCost), regardless of the budget of the formatter.
+func (f *Formatter) Cost(o interface{}, fields []string) (int, error) {
+	return f.CostContext(context.Background(), o, fields)
+}
+
+// CostContext is like Cost, ctx giving the authorization profile (see WithAuthorizer).
+func (f *Formatter) CostContext(ctx context.Context, o interface{}, fields []string) (int, error) {
+	if o == nil {
+		return 0, nil
+	}
+	c, err := f.compileBudget(ctx, reflect.TypeOf(o), fields, f.lenient, 0)
+	if err != nil {
+		return 0, err
+	}
+	return c.cost, nil
+}
+
+// compileBudget is like compileMode, selections costing more than budget being rejected (if not 0).
+// Compilations exceeding the limits are not cached.
+func (f *Formatter) compileBudget(ctx context.Context, t reflect.Type, fields []string, lenient bool, budget int) (*compiled, error) {
+	if err := f.limits.check(fields); err != nil {
+		return nil, err
+	}
+	key := compiledKey{fields: strings.Join(fields, ","), lenient: lenient}
+	if f.authorizer != nil {
+		key.profile = f.authorizer.Profile(ctx)
+	}
+	f.mu.Lock()
+	b, err := f.builderLocked(t)
+	var c *compiled
+	if err == nil {
+		c = f.compiled[t][key]
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		if err := f.checkCompiled(c, fields, budget); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	// the authorizer is called unlocked, concurrent compilations of a selection keeping the first one cached
+	c, err = f.compileBuilder(ctx, t, b, fields, lenient)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkCompiled(c, fields, budget); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	if cached := f.compiled[t][key]; cached != nil {
+		c = cached
+	} else {
+		f.compiled[t][key] = c
+	}
+	f.mu.Unlock()
+	return c, nil
+}
+
+// checkCompiled returns a LimitError if the selected fields, once expanded, exceed the limits or cost more than budget
+// (if not 0).
+func (f *Formatter) checkCompiled(c *compiled, fields []string, budget int) error {
+	// empty selections select all the fields of the formatted type, not chosen by clients
+	if f.limits.MaxFields > 0 && len(fields) > 0 && c.count > f.limits.MaxFields {
+		return &LimitError{Limit: "fields", Max: f.limits.MaxFields, Value: c.count}
+	}
+	if budget > 0 && c.cost > budget {
+		return &LimitError{Limit: "cost", Max: budget, Value: c.cost}
+	}
+	return nil
+}
+
+// compileBuilder compiles the given fields with b, the builder of type t.
+func (f *Formatter) compileBuilder(ctx context.Context, t reflect.Type, b builder, fields []string, lenient bool) (*compiled, error) {
+	comp := &compilation{
+		objects:    f.objects,
+		lenient:    lenient,
+		pool:       f.pool,
+		costs:      f.costs,
+		sliceMul:   f.sliceMul,
+		factor:     1,
+		ctx:        ctx,
+		authorizer: f.authorizer,
+		drop:       f.authPolicy == DropForbidden,
+		maskers:    f.maskers,
+		audited:    f.audit != nil,
+		output:     f.elementLimits(),
+	}
+	ff, err := b.build(comp, fields, "")
+	if err != nil {
+		return nil, err
+	}
+	c := &compiled{
+		formatter: ff,
+		fields:    withoutPaths(withoutPaths(fields, comp.ignored), comp.denied),
+		ignored:   comp.ignored,
+		denied:    comp.denied,
+		cost:      comp.cost,
+		count:     comp.count,
+		pii:       comp.pii,
+	}
+	if comp.expanded {
+		c.fields = comp.selected
+	}
+	// ProjectJSON methods cannot tell which fields are authorized when expanding selections,
+	// nor mask them or limit slices
+	if !f.objects && len(c.fields) > 0 && !comp.expanded && comp.masks == 0 && comp.output == nil {
+		c.projector = makeProjectorFormatter(t, c.fields)
+	}
+	return c, nil
+}
+
+// withoutPaths returns the fields not selecting any of paths (or any of their subfields).
+func withoutPaths(fields, paths []string) []string {
+	if len(paths) == 0 {
+		return fields
+	}
+	var kept []string
+	for _, field := range fields {
+		if !selectsAny(field, paths) {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+func selectsAny(field string, paths []string) bool {
+	for _, path := range paths {
+		if field == path || strings.HasPrefix(field, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// selectedFields returns the fields selected for type t, without the unknown ones ignored in lenient mode
+// or the unauthorized ones, selections being expanded to the authorized fields if needed.
+func (f *Formatter) selectedFields(ctx context.Context, t reflect.Type, fields []string) ([]string, error) {
+	if len(fields) == 0 && !f.restricted(t) {
+		return nil, nil
+	}
+	c, err := f.compile(ctx, t, fields)
+	if err != nil {
+		return nil, err
+	}
+	return c.fields, nil
+}
+
+// builder returns the cached builder of type t, making it if needed.
+func (f *Formatter) builder(t reflect.Type) (builder, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
+	return f.builderLocked(t)
+}
+
+func (f *Formatter) builderLocked(t reflect.Type) (builder, error) {
 	b := f.builders[t]
 	if b == nil {
 		var err error
-		b, err = makeBuilder(t)
+		b, err = makeBuilder(t, map[reflect.Type]bool{})
 		if err != nil {
 			return nil, err
 		}
-		f.builders[t] = b
-		f.formatters[t] = map[string]formatter{}
-	}
-	key := strings.Join(fields, ",")
-	ff := f.formatters[t][key]
-	if ff == nil {
-		var err error
-		ff, err = b.build(fields, "")
-		if err != nil {
+		if err := checkMaskers(b, f.maskers); err != nil {
 			return nil, err
 		}
-		f.formatters[t][key] = ff
-	}
-	v, err := ff.format(v)
-	if err != nil {
-		return nil, err
+		f.builders[t] = b
+		f.compiled[t] = map[compiledKey]*compiled{}
+		f.sensitive[t] = hasTagged(b, func(sb *structBuilder) bool {
+			return len(sb.masks) > 0 || f.audit != nil && len(sb.pii) > 0
+		})
 	}
-	return v.Interface(), nil
+	return b, nil
 }
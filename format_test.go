@@ -1,9 +1,12 @@
 package dynjson
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -42,7 +45,7 @@ func TestFormat(t *testing.T) {
 				} `json:"foo"`
 			}{},
 			format: "foo.baz",
-			err:    "field 'foo.baz' does not exist",
+			err:    "field 'foo.baz' does not exist, did you mean 'bar'?",
 		},
 		{
 			src: struct {
@@ -398,38 +401,53 @@ func TestFormat(t *testing.T) {
 			format: "foo.bar",
 			output: `{"foo":[{"bar":1}]}`,
 		},
+		{
+			src: struct {
+				Foo []struct {
+					Bar int `json:"bar"`
+				} `json:"foo"`
+			}{},
+			format: "foo.bar",
+			output: `{"foo":[]}`,
+		},
 	}
 	for i, tt := range tests {
 		t.Run(fmt.Sprintf("test #%d", i), func(t *testing.T) {
-			f := NewFormatter()
-			var fields []string
-			if tt.format != "" {
-				fields = strings.Split(tt.format, ",")
-			}
-			o, err := f.Format(tt.src, fields)
-			if tt.err != "" {
-				if err == nil {
-					t.FailNow()
-				}
-				if tt.err != err.Error() {
-					t.Errorf("Returned error '%v', expected '%s'", err, tt.err)
-				}
-			} else {
-				if err != nil {
-					t.Error("Should not have returned", err)
-				}
-				buf, err := json.Marshal(o)
-				if err != nil {
-					t.Error("Should not have returned", err)
-				}
-				if tt.output != string(buf) {
-					t.Errorf("Returned '%s', expected '%s'", string(buf), tt.output)
-				}
-			}
+			testFormat(t, NewFormatter(), tt.src, tt.format, tt.output, tt.err)
+		})
+		t.Run(fmt.Sprintf("test #%d with objects", i), func(t *testing.T) {
+			testFormat(t, NewFormatter(WithObjects()), tt.src, tt.format, tt.output, tt.err)
 		})
 	}
 }
 
+func testFormat(t *testing.T, f *Formatter, src interface{}, format, output, expectedErr string) {
+	var fields []string
+	if format != "" {
+		fields = strings.Split(format, ",")
+	}
+	o, err := f.Format(src, fields)
+	if expectedErr != "" {
+		if err == nil {
+			t.FailNow()
+		}
+		if expectedErr != err.Error() {
+			t.Errorf("Returned error '%v', expected '%s'", err, expectedErr)
+		}
+	} else {
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		buf, err := json.Marshal(o)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if output != string(buf) {
+			t.Errorf("Returned '%s', expected '%s'", string(buf), output)
+		}
+	}
+}
+
 func TestFormatAnonymous(t *testing.T) {
 	type Embedded struct {
 		Foo int `json:"foo"`
@@ -475,6 +493,39 @@ func TestFormatRecursion(t *testing.T) {
 	}
 }
 
+func TestFormatSliceRecursion(t *testing.T) {
+	type Recursive struct {
+		Foo []*Recursive `json:"foo"`
+		Bar int          `json:"bar"`
+	}
+	src := Recursive{Foo: []*Recursive{{Bar: 2}}, Bar: 1}
+	var tests = []struct {
+		fields []string
+		output string
+	}{
+		{fields: []string{"bar"}, output: `{"bar":1}`},
+		{fields: []string{"foo", "bar"}, output: `{"foo":[{"foo":null,"bar":2}],"bar":1}`},
+		{output: `{"foo":[{"foo":null,"bar":2}],"bar":1}`},
+	}
+	for _, tt := range tests {
+		o, err := NewFormatter().Format(src, tt.fields)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		buf, err := json.Marshal(o)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if string(buf) != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", string(buf), tt.output)
+		}
+	}
+	_, err := NewFormatter().Format(src, []string{"foo.bar"})
+	if _, ok := err.(*UnknownFieldError); !ok {
+		t.Errorf("Returned '%v', expected an UnknownFieldError", err)
+	}
+}
+
 func TestMultipleFields(t *testing.T) {
 	src := struct {
 		Foo int    `json:"foo"`
@@ -491,6 +542,39 @@ func TestMultipleFields(t *testing.T) {
 	}
 }
 
+func TestFormatContextCanceled(t *testing.T) {
+	src := make([]struct {
+		Foo int `json:"foo"`
+	}, 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	f := NewFormatter()
+	_, err := f.FormatContext(ctx, src, []string{"foo"})
+	if err != context.Canceled {
+		t.Errorf("Returned '%v', expected '%v'", err, context.Canceled)
+	}
+	f = NewFormatter(WithParallelism(10, 4))
+	_, err = f.FormatContext(ctx, src, []string{"foo"})
+	if err != context.Canceled {
+		t.Errorf("Returned '%v', expected '%v'", err, context.Canceled)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	src := struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}{Foo: 1, Bar: "bar"}
+	var buf bytes.Buffer
+	err := NewFormatter().EncodeContext(context.Background(), &buf, src, []string{"bar"})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if buf.String() != "{\"bar\":\"bar\"}\n" {
+		t.Errorf("Returned '%s', expected '%s'", buf.String(), "{\"bar\":\"bar\"}\n")
+	}
+}
+
 func BenchmarkFormat_Fields(b *testing.B) {
 	f := NewFormatter()
 	w := json.NewEncoder(ioutil.Discard)
@@ -524,3 +608,138 @@ func BenchmarkRawJSON(b *testing.B) {
 		}{Foo: i, Bar: "bar"})
 	}
 }
+
+func TestFormatLenient(t *testing.T) {
+	type Sub struct {
+		Baz int `json:"baz"`
+	}
+	src := []struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+		Sub Sub    `json:"sub"`
+	}{{Foo: 1, Bar: "bar", Sub: Sub{Baz: 2}}}
+	var tests = []struct {
+		fields  []string
+		output  string
+		ignored []string
+	}{
+		{fields: []string{"foo", "qux", "sub.baz", "sub.quux", "bar.len"}, output: `[{"foo":1,"sub":{"baz":2}}]`, ignored: []string{"qux", "sub.quux", "bar.len"}},
+		{fields: []string{"qux"}, output: `[{}]`, ignored: []string{"qux"}},
+		{fields: []string{"bar"}, output: `[{"bar":"bar"}]`},
+	}
+	for _, tt := range tests {
+		for _, f := range []*Formatter{NewFormatter(WithLenient()), NewFormatter(WithLenient(), WithObjects())} {
+			var report Report
+			o, err := f.Format(src, tt.fields, WithReport(&report))
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			buf, _ := json.Marshal(o)
+			if string(buf) != tt.output {
+				t.Errorf("Returned '%s', expected '%s'", string(buf), tt.output)
+			}
+			if strings.Join(report.Ignored, ",") != strings.Join(tt.ignored, ",") {
+				t.Errorf("Returned %v, expected %v", report.Ignored, tt.ignored)
+			}
+		}
+	}
+	f := NewFormatter()
+	_, err := f.Format(src, []string{"foo", "qux"})
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+	o, err := f.Format(src, []string{"foo", "qux"}, Lenient())
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	buf, _ := json.Marshal(o)
+	if string(buf) != `[{"foo":1}]` {
+		t.Errorf("Returned '%s', expected '%s'", string(buf), `[{"foo":1}]`)
+	}
+	_, err = f.Format(src, []string{"foo", "qux"})
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+}
+
+type costItem struct {
+	SKU   string `json:"sku"`
+	Price int    `json:"price" dynjson:"cost=3"`
+}
+
+type costOrder struct {
+	ID       int        `json:"id"`
+	Customer string     `json:"customer" dynjson:"cost=10"`
+	Items    []costItem `json:"items" dynjson:"cost=5"`
+}
+
+func TestFormatCost(t *testing.T) {
+	var tests = []struct {
+		opts   []FormatterOption
+		src    interface{}
+		fields []string
+		cost   int
+	}{
+		{src: costOrder{}, fields: []string{"id"}, cost: 1},
+		{src: costOrder{}, fields: []string{"id", "customer", "items"}, cost: 20},
+		{src: costOrder{}, cost: 20},
+		{src: costOrder{}, fields: []string{"items"}, cost: 45, opts: []FormatterOption{WithSliceMultiplier(10)}},
+		{src: costOrder{}, fields: []string{"items.sku", "items.price"}, cost: 9},
+		{src: costOrder{}, fields: []string{"items.sku", "items.price", "foo"}, cost: 9, opts: []FormatterOption{WithLenient()}},
+		{src: costOrder{}, fields: []string{"items.sku", "items.price"}, cost: 45, opts: []FormatterOption{WithSliceMultiplier(10)}},
+		{src: []costOrder{}, fields: []string{"id", "items.price"}, cost: 360, opts: []FormatterOption{WithSliceMultiplier(10)}},
+		{src: costOrder{}, fields: []string{"id", "customer"}, cost: 3, opts: []FormatterOption{WithFieldCost[costOrder]("customer", 2)}},
+	}
+	for _, tt := range tests {
+		f := NewFormatter(tt.opts...)
+		cost, err := f.Cost(tt.src, tt.fields)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if cost != tt.cost {
+			t.Errorf("%v: returned %d, expected %d", tt.fields, cost, tt.cost)
+		}
+		var report Report
+		_, err = f.Format(tt.src, tt.fields, WithReport(&report))
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if report.Cost != tt.cost {
+			t.Errorf("%v: returned %d, expected %d", tt.fields, report.Cost, tt.cost)
+		}
+	}
+	p, err := CompileWith[costOrder](NewFormatter(), []string{"customer", "items.sku"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	if p.Cost() != 16 {
+		t.Errorf("Returned %d, expected %d", p.Cost(), 16)
+	}
+}
+
+func TestFormatBudget(t *testing.T) {
+	f := NewFormatter(WithBudget(19))
+	_, err := f.Format(costOrder{}, []string{"id", "customer", "items"})
+	if err == nil {
+		t.Fatal("Expected error but returned nil")
+	}
+	msg := "selection cost (20) exceeds the limit (19)"
+	if err.Error() != msg {
+		t.Errorf("Returned '%s', expected '%s'", err.Error(), msg)
+	}
+	if len(f.compiled[reflect.TypeOf(costOrder{})]) != 0 {
+		t.Errorf("Returned %d compilations, expected 0", len(f.compiled[reflect.TypeOf(costOrder{})]))
+	}
+	cost, err := f.Cost(costOrder{}, []string{"id", "customer", "items"})
+	if err != nil || cost != 20 {
+		t.Errorf("Returned %d, %v, expected 20", cost, err)
+	}
+	_, err = f.Format(costOrder{}, nil)
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+	_, err = f.Format(costOrder{}, []string{"customer", "items"})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+}
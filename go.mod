@@ -1,3 +1,3 @@
 module github.com/cocoonspace/dynjson
 
-go 1.16
+go 1.18
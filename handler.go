@@ -0,0 +1,175 @@
+package dynjson
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// HandlerOption defines a Handler option.
+type HandlerOption func(*handler)
+
+// HandlerFormatter makes the handler use f instead of a package-wide formatter.
+func HandlerFormatter(f *Formatter) HandlerOption {
+	return func(h *handler) {
+		h.f = f
+	}
+}
+
+// HandlerParseOptions sets the options used to get the selected fields from the request (see ParseRequest).
+func HandlerParseOptions(opts *ParseOptions) HandlerOption {
+	return func(h *handler) {
+		h.parse = opts
+	}
+}
+
+// HandlerStatus sets a hook returning the status code of the response, given the value or error
+// returned by the handler function. Returning 0 keeps the default status.
+func HandlerStatus(fn func(r *http.Request, v interface{}, err error) int) HandlerOption {
+	return func(h *handler) {
+		h.status = fn
+	}
+}
+
+// HandlerHeaders sets a hook called before writing successful responses, to set additional headers.
+func HandlerHeaders(fn func(h http.Header, r *http.Request, v interface{})) HandlerOption {
+	return func(h *handler) {
+		h.headers = fn
+	}
+}
+
+// HandlerProblems makes the handler answer invalid selections with problem documents (see SelectionProblem).
+func HandlerProblems() HandlerOption {
+	return func(h *handler) {
+		h.problems = true
+	}
+}
+
+// HandlerIgnoredHeader makes the handler list the unknown paths ignored by lenient formatters (see WithLenient)
+// in the given response header, comma separated.
+func HandlerIgnoredHeader(name string) HandlerOption {
+	return func(h *handler) {
+		h.ignoredHeader = name
+	}
+}
+
+// HandlerRoute makes the handler restrict the selections to the ones allowed for route
+// by the policy of its formatter (see WithPolicy), denied fields being answered with 403 Forbidden.
+func HandlerRoute(route string) HandlerOption {
+	return func(h *handler) {
+		h.route = route
+	}
+}
+
+type handler struct {
+	fn            func(r *http.Request) (interface{}, error)
+	f             *Formatter
+	parse         *ParseOptions
+	route         string
+	problems      bool
+	ignoredHeader string
+	status        func(r *http.Request, v interface{}, err error) int
+	headers       func(h http.Header, r *http.Request, v interface{})
+}
+
+// Handler returns a http.Handler writing the selected fields of the values returned by fn,
+// encoded according to the Accept header (see Formatter.Respond).
+//
+// Invalid requests and selections are answered with 400 Bad Request, before calling fn for requests,
+// and errors returned by fn with 500 Internal Server Error,
+// unless HandlerStatus is used. A nil value is answered with 204 No Content.
+func Handler(fn func(r *http.Request) (interface{}, error), opts ...HandlerOption) http.Handler {
+	h := &handler{fn: fn, f: defaultFormatter}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requested, err := ParseRequest(r, h.parse)
+	if err != nil {
+		h.selectionError(w, r, err, nil)
+		return
+	}
+	v, err := h.fn(r)
+	if err != nil {
+		h.error(w, r, err, http.StatusInternalServerError)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(h.statusCode(r, nil, nil, http.StatusNoContent))
+		return
+	}
+	fields := requested
+	if h.route != "" {
+		fields, err = h.f.SelectRoute(h.route, requested)
+	}
+	if err == nil && (len(fields) > 0 || h.f.restricted(reflect.TypeOf(v))) {
+		// selection errors are told apart from encoding ones by compiling first
+		var c *compiled
+		c, err = h.f.compile(r.Context(), reflect.TypeOf(v), fields)
+		if err == nil && h.ignoredHeader != "" && len(c.ignored) > 0 {
+			w.Header().Set(h.ignoredHeader, strings.Join(c.ignored, ","))
+		}
+	}
+	if err != nil {
+		// fields of presets are not located in the request
+		h.selectionError(w, r, err, requested)
+		return
+	}
+	if h.headers != nil {
+		h.headers(w.Header(), r, v)
+	}
+	rw := &statusWriter{ResponseWriter: w}
+	err = h.f.respond(rw, r, v, h.statusCode(r, v, nil, http.StatusOK), fields)
+	if err != nil && !rw.written {
+		h.error(w, r, err, http.StatusInternalServerError)
+	}
+}
+
+// statusWriter records whether the status has been written.
+type statusWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.written = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.written = true
+	return w.ResponseWriter.Write(b)
+}
+
+// selectionError answers an invalid request or selection of fields.
+func (h *handler) selectionError(w http.ResponseWriter, r *http.Request, err error, fields []string) {
+	if p := SelectionProblem(err, h.parse.params()[0], fields); p != nil && h.problems {
+		p.Status = h.statusCode(r, nil, err, p.Status)
+		p.Title = http.StatusText(p.Status)
+		_ = p.Write(w)
+		return
+	}
+	h.error(w, r, err, selectionStatus(err))
+}
+
+func (h *handler) statusCode(r *http.Request, v interface{}, err error, status int) int {
+	if h.status != nil {
+		if s := h.status(r, v, err); s != 0 {
+			return s
+		}
+	}
+	return status
+}
+
+func (h *handler) error(w http.ResponseWriter, r *http.Request, err error, status int) {
+	status = h.statusCode(r, nil, err, status)
+	msg := http.StatusText(status)
+	if status < http.StatusInternalServerError {
+		msg = err.Error()
+	}
+	http.Error(w, msg, status)
+}
@@ -0,0 +1,142 @@
+package dynjson
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	type Item struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}
+	errNotFound := errors.New("not found")
+	h := Handler(func(r *http.Request) (interface{}, error) {
+		switch r.URL.Path {
+		case "/item":
+			return &Item{Foo: 1, Bar: "bar"}, nil
+		case "/empty":
+			return nil, nil
+		case "/missing":
+			return nil, errNotFound
+		}
+		return nil, errors.New("database is down")
+	},
+		HandlerFormatter(NewFormatter(WithObjects())),
+		HandlerStatus(func(r *http.Request, v interface{}, err error) int {
+			if err == errNotFound {
+				return http.StatusNotFound
+			}
+			if r.Method == http.MethodPost && err == nil {
+				return http.StatusCreated
+			}
+			return 0
+		}),
+		HandlerHeaders(func(h http.Header, r *http.Request, v interface{}) {
+			h.Set("X-Foo", "foo")
+		}),
+	)
+	var tests = []struct {
+		method string
+		url    string
+		status int
+		body   string
+		header string
+	}{
+		{method: http.MethodGet, url: "/item?select=foo,bar", status: http.StatusOK, body: `{"foo":1,"bar":"bar"}` + "\n", header: "foo"},
+		{method: http.MethodPost, url: "/item?select=bar", status: http.StatusCreated, body: `{"bar":"bar"}` + "\n", header: "foo"},
+		{method: http.MethodGet, url: "/item", status: http.StatusOK, body: `{"foo":1,"bar":"bar"}` + "\n", header: "foo"},
+		{method: http.MethodGet, url: "/item?select=baz", status: http.StatusBadRequest, body: "field 'baz' does not exist, did you mean 'bar'?\n"},
+		{method: http.MethodGet, url: "/missing?select=%zz", status: http.StatusBadRequest, body: "invalid query: invalid URL escape \"%zz\"\n"},
+		{method: http.MethodGet, url: "/empty", status: http.StatusNoContent},
+		{method: http.MethodGet, url: "/missing", status: http.StatusNotFound, body: "not found\n"},
+		{method: http.MethodGet, url: "/broken", status: http.StatusInternalServerError, body: "Internal Server Error\n"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://api.example.com"+tt.url, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: returned %d, expected %d", tt.url, w.Code, tt.status)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: returned '%s', expected '%s'", tt.url, w.Body.String(), tt.body)
+		}
+		if w.Header().Get("X-Foo") != tt.header {
+			t.Errorf("%s: returned '%s', expected '%s'", tt.url, w.Header().Get("X-Foo"), tt.header)
+		}
+	}
+}
+
+func TestHandlerNotAcceptable(t *testing.T) {
+	h := Handler(func(r *http.Request) (interface{}, error) {
+		return struct{}{}, nil
+	})
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+	r.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("Returned %d, expected %d", w.Code, http.StatusNotAcceptable)
+	}
+	if !strings.HasPrefix(w.Body.String(), "application/json\n") {
+		t.Errorf("Returned '%s', expected the supported media types", w.Body.String())
+	}
+}
+
+func TestHandlerIgnoredHeader(t *testing.T) {
+	h := Handler(func(r *http.Request) (interface{}, error) {
+		return errorsSubItem{Name: "name"}, nil
+	}, HandlerFormatter(NewFormatter(WithLenient())), HandlerIgnoredHeader("X-Ignored-Fields"))
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/?select=name&select=foo&select=bar.baz", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Returned %d, expected %d", w.Code, http.StatusOK)
+	}
+	if w.Body.String() != `{"name":"name"}`+"\n" {
+		t.Errorf("Returned '%s', expected '%s'", w.Body.String(), `{"name":"name"}`+"\n")
+	}
+	if h := w.Header().Get("X-Ignored-Fields"); h != "foo,bar" {
+		t.Errorf("Returned '%s', expected '%s'", h, "foo,bar")
+	}
+}
+
+func TestHandlerParseOptions(t *testing.T) {
+	type Item struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}
+	calls := 0
+	h := Handler(func(r *http.Request) (interface{}, error) {
+		calls++
+		return Item{Foo: 1, Bar: "bar"}, nil
+	}, HandlerParseOptions(&ParseOptions{Header: "X-Fields", MaxLength: 5}), HandlerProblems())
+	var tests = []struct {
+		fields string
+		status int
+		body   string
+		calls  int
+	}{
+		{fields: "foo", status: http.StatusOK, body: `{"foo":1}` + "\n", calls: 1},
+		{fields: "foo,bar", status: http.StatusBadRequest, body: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"selection exceeds 5 characters","errors":[]}` + "\n", calls: 1},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/", nil)
+		r.Header.Set("X-Fields", tt.fields)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: returned %d, expected %d", tt.fields, w.Code, tt.status)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: returned '%s', expected '%s'", tt.fields, w.Body.String(), tt.body)
+		}
+		if calls != tt.calls {
+			t.Errorf("%s: returned %d calls, expected %d", tt.fields, calls, tt.calls)
+		}
+	}
+}
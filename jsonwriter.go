@@ -0,0 +1,154 @@
+package dynjson
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+// JSONWriter is a JSON output buffer used by generated ProjectJSON methods.
+//
+// Its output is identical to the output of encoding/json.
+type JSONWriter struct {
+	buf []byte
+}
+
+// Bytes returns the written bytes.
+func (w *JSONWriter) Bytes() []byte {
+	return w.buf
+}
+
+// Reset empties the buffer.
+func (w *JSONWriter) Reset() {
+	w.buf = w.buf[:0]
+}
+
+// Raw writes s unmodified.
+func (w *JSONWriter) Raw(s string) {
+	w.buf = append(w.buf, s...)
+}
+
+// Byte writes c unmodified.
+func (w *JSONWriter) Byte(c byte) {
+	w.buf = append(w.buf, c)
+}
+
+// Bool writes a JSON boolean.
+func (w *JSONWriter) Bool(b bool) {
+	w.buf = strconv.AppendBool(w.buf, b)
+}
+
+// Int writes a JSON number.
+func (w *JSONWriter) Int(i int64) {
+	w.buf = strconv.AppendInt(w.buf, i, 10)
+}
+
+// Uint writes a JSON number.
+func (w *JSONWriter) Uint(u uint64) {
+	w.buf = strconv.AppendUint(w.buf, u, 10)
+}
+
+// Float writes a JSON number, bits being either 32 or 64.
+func (w *JSONWriter) Float(f float64, bits int) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return &json.UnsupportedValueError{Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	w.buf = strconv.AppendFloat(w.buf, f, format, -1, bits)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(w.buf)
+		if n >= 4 && w.buf[n-4] == 'e' && w.buf[n-3] == '-' && w.buf[n-2] == '0' {
+			w.buf[n-2] = w.buf[n-1]
+			w.buf = w.buf[:n-1]
+		}
+	}
+	return nil
+}
+
+const hex = "0123456789abcdef"
+
+// String writes a JSON string, escaped like encoding/json does.
+func (w *JSONWriter) String(s string) {
+	w.buf = append(w.buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			w.buf = append(w.buf, s[start:i]...)
+			switch c {
+			case '\\', '"':
+				w.buf = append(w.buf, '\\', c)
+			case '\n':
+				w.buf = append(w.buf, '\\', 'n')
+			case '\r':
+				w.buf = append(w.buf, '\\', 'r')
+			case '\t':
+				w.buf = append(w.buf, '\\', 't')
+			default:
+				w.buf = append(w.buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			w.buf = append(w.buf, s[start:i]...)
+			w.buf = utf8.AppendRune(w.buf, utf8.RuneError)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			w.buf = append(w.buf, s[start:i]...)
+			w.buf = append(w.buf, '\\', 'u', '2', '0', '2', hex[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	w.buf = append(w.buf, s[start:]...)
+	w.buf = append(w.buf, '"')
+}
+
+// Value writes the encoding/json encoding of v.
+func (w *JSONWriter) Value(v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.buf = append(w.buf, buf...)
+	return nil
+}
+
+// Project writes the JSON encoding of the selected fields of v, using reflection.
+func (w *JSONWriter) Project(v interface{}, sel Selection) error {
+	o, err := reflectFormatter.Format(v, sel.Paths())
+	if err != nil {
+		return err
+	}
+	return w.Value(o)
+}
+
+// UnknownField returns the error reported by generated ProjectJSON methods for an unknown field.
+func UnknownField(name string) error {
+	return &UnknownFieldError{Path: name}
+}
+
+// IsEmpty reports whether v is omitted by encoding/json when tagged with the omitempty option.
+func IsEmpty(v interface{}) bool {
+	return v == nil || isEmptyValue(reflect.ValueOf(v))
+}
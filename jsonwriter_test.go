@@ -0,0 +1,45 @@
+package dynjson
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestJSONWriterString(t *testing.T) {
+	for _, s := range []string{"", "foo", "\"\\\n\r\t\x01", "<a&b>", "é\u2028\u2029", "\xff", "日本"} {
+		var w JSONWriter
+		w.String(s)
+		expected, _ := json.Marshal(s)
+		if string(w.Bytes()) != string(expected) {
+			t.Errorf("Returned '%s', expected '%s'", string(w.Bytes()), string(expected))
+		}
+	}
+}
+
+func TestJSONWriterFloat(t *testing.T) {
+	for _, f := range []float64{0, 1, -1.5, 1e-7, 1e20, 1e21, 123456789.123, math.MaxFloat64} {
+		var w JSONWriter
+		err := w.Float(f, 64)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		expected, _ := json.Marshal(f)
+		if string(w.Bytes()) != string(expected) {
+			t.Errorf("Returned '%s', expected '%s'", string(w.Bytes()), string(expected))
+		}
+		w.Reset()
+		err = w.Float(float64(float32(f)), 32)
+		if err != nil && f != math.MaxFloat64 {
+			t.Error("Should not have returned", err)
+		}
+		expected, _ = json.Marshal(float32(f))
+		if err == nil && string(w.Bytes()) != string(expected) {
+			t.Errorf("Returned '%s', expected '%s'", string(w.Bytes()), string(expected))
+		}
+	}
+	var w JSONWriter
+	if w.Float(math.NaN(), 64) == nil {
+		t.Error("Expected error but returned nil")
+	}
+}
@@ -0,0 +1,157 @@
+package dynjson
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Masker transforms the string representation of a sensitive value, e.g. hiding all but its last characters.
+type Masker func(s string) string
+
+// defaultMaskers are the maskers available to all the formatters, by name.
+var defaultMaskers = map[string]Masker{
+	"email": MaskEmail,
+	"last4": MaskLast4,
+}
+
+// MaskEmail keeps the first character of the local part of an email address and its domain, as in j***@example.com.
+func MaskEmail(s string) string {
+	at := strings.LastIndex(s, "@")
+	if at == -1 {
+		return stars(s)
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	if size >= at {
+		return stars(s[:at]) + s[at:]
+	}
+	return s[:size] + stars(s[size:at]) + s[at:]
+}
+
+// MaskLast4 keeps the last 4 characters of s (card numbers, phone numbers...), or none if s is not longer.
+func MaskLast4(s string) string {
+	n := utf8.RuneCountInString(s)
+	if n <= 4 {
+		return stars(s)
+	}
+	i := len(s)
+	for k := 0; k < 4; k++ {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return strings.Repeat("*", n-4) + s[i:]
+}
+
+// stars returns as many stars as s has characters.
+func stars(s string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(s))
+}
+
+// WithMasker registers m as the masker named name, for fields tagged with dynjson:"mask=name".
+// The email and last4 maskers are predefined (see MaskEmail and MaskLast4), and can be replaced.
+//
+// Masked fields must be strings, numbers or pointers to them, and are output as strings (or pointers to strings).
+// Types with fields tagged with an unknown masker cannot be formatted, a MaskerError being returned.
+func WithMasker(name string, m Masker) FormatterOption {
+	return func(f *Formatter) {
+		f.maskers[name] = m
+	}
+}
+
+// Unmasker can be implemented by an Authorizer to let callers see masked fields as is.
+type Unmasker interface {
+	// Unmask reports whether the caller may see the field at path unmasked, t being the struct type holding it.
+	// Its result must only depend on the profile of ctx.
+	Unmask(ctx context.Context, t reflect.Type, path string) bool
+}
+
+// checkMaskers returns a MaskerError if fields of b, or of the struct builders under it, have unknown maskers.
+func checkMaskers(b builder, maskers map[string]Masker) error {
+	var err error
+	hasTagged(b, func(sb *structBuilder) bool {
+		for _, name := range sb.names {
+			if m := sb.masks[name]; m != "" && maskers[m] == nil {
+				err = &MaskerError{Type: sb.t, Field: name, Masker: m}
+				return true
+			}
+		}
+		return false
+	})
+	return err
+}
+
+// masked reports whether the field at path of struct type t, with the given masker name, is masked.
+func (c *compilation) masked(t reflect.Type, path, name string) bool {
+	if name == "" {
+		return false
+	}
+	u, ok := c.authorizer.(Unmasker)
+	return !ok || !u.Unmask(c.ctx, t, path)
+}
+
+// mask returns the formatter masking the values of type t at path with the masker named name.
+func (c *compilation) mask(t reflect.Type, path, name string) (formatter, error) {
+	m := c.maskers[name]
+	if !isMaskable(t) {
+		return nil, &UnsupportedTypeError{Path: path, Type: t}
+	}
+	c.masks++
+	if t.Kind() == reflect.Ptr {
+		return &maskFormatter{t: reflect.PtrTo(stringType), mask: m}, nil
+	}
+	return &maskFormatter{t: stringType, mask: m}, nil
+}
+
+var stringType = reflect.TypeOf("")
+
+// isMaskable reports whether values of type t have a string representation that can be masked.
+func isMaskable(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+type maskFormatter struct {
+	t    reflect.Type
+	mask Masker
+}
+
+func (f *maskFormatter) typ() reflect.Type {
+	return f.t
+}
+
+func (f *maskFormatter) format(ctx context.Context, src reflect.Value) (reflect.Value, error) {
+	if src.Kind() != reflect.Ptr {
+		return reflect.ValueOf(f.mask(maskString(src))), nil
+	}
+	if src.IsNil() {
+		return reflect.Zero(f.t), nil
+	}
+	s := f.mask(maskString(src.Elem()))
+	return reflect.ValueOf(&s), nil
+}
+
+// maskString returns the string representation of v, as encoded in JSON.
+func maskString(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	return v.String()
+}
@@ -0,0 +1,131 @@
+package dynjson
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMaskers(t *testing.T) {
+	var tests = []struct {
+		masker Masker
+		input  string
+		output string
+	}{
+		{masker: MaskEmail, input: "john.doe@example.com", output: "j*******@example.com"},
+		{masker: MaskEmail, input: "j@example.com", output: "*@example.com"},
+		{masker: MaskEmail, input: "élodie@example.com", output: "é*****@example.com"},
+		{masker: MaskEmail, input: "john", output: "****"},
+		{masker: MaskLast4, input: "4111111111111111", output: "************1111"},
+		{masker: MaskLast4, input: "+33 6 12 34 56 78", output: "*************6 78"},
+		{masker: MaskLast4, input: "1234", output: "****"},
+		{masker: MaskLast4, input: "", output: ""},
+	}
+	for _, tt := range tests {
+		if output := tt.masker(tt.input); output != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", output, tt.output)
+		}
+	}
+}
+
+type maskCard struct {
+	Number int64   `json:"number" dynjson:"mask=last4"`
+	Holder *string `json:"holder,omitempty" dynjson:"mask=initials"`
+}
+
+type maskCustomer struct {
+	ID    int        `json:"id"`
+	Email string     `json:"email" dynjson:"mask=email"`
+	Code  int        `json:"code,string" dynjson:"mask=last4"`
+	Cards []maskCard `json:"cards"`
+}
+
+// supportAuthorizer lets the support profile see masked emails.
+type supportAuthorizer struct{}
+
+func (supportAuthorizer) Profile(ctx context.Context) string {
+	role, _ := ctx.Value(authKey{}).(string)
+	return role
+}
+
+func (supportAuthorizer) Authorize(ctx context.Context, t reflect.Type, path string) bool {
+	return true
+}
+
+func (supportAuthorizer) Unmask(ctx context.Context, t reflect.Type, path string) bool {
+	role, _ := ctx.Value(authKey{}).(string)
+	return role == "support" && path == "email"
+}
+
+func TestFormatMask(t *testing.T) {
+	holder := "John Doe"
+	src := maskCustomer{ID: 1, Email: "john@example.com", Code: 123456, Cards: []maskCard{{Number: 4111111111111111, Holder: &holder}, {Number: 5500000000000004}}}
+	initials := WithMasker("initials", func(s string) string {
+		var initials string
+		for _, w := range strings.Fields(s) {
+			initials += w[:1] + "."
+		}
+		return initials
+	})
+	support := context.WithValue(context.Background(), authKey{}, "support")
+	var tests = []struct {
+		ctx    context.Context
+		opts   []FormatterOption
+		fields []string
+		output string
+	}{
+		{fields: []string{"id", "email", "code"}, output: `{"id":1,"email":"j***@example.com","code":"**3456"}`},
+		{fields: []string{"cards.number", "cards.holder"}, output: `{"cards":[{"number":"************1111","holder":"J.D."},{"number":"************0004"}]}`},
+		{output: `{"id":1,"email":"j***@example.com","code":"**3456","cards":[{"number":"************1111","holder":"J.D."},{"number":"************0004"}]}`},
+		{fields: []string{"cards"}, output: `{"cards":[{"number":"************1111","holder":"J.D."},{"number":"************0004"}]}`},
+		{ctx: support, opts: []FormatterOption{WithAuthorizer(supportAuthorizer{}, DenyForbidden)}, fields: []string{"email", "code"}, output: `{"email":"john@example.com","code":"**3456"}`},
+		{opts: []FormatterOption{WithAuthorizer(supportAuthorizer{}, DenyForbidden)}, fields: []string{"email"}, output: `{"email":"j***@example.com"}`},
+		{opts: []FormatterOption{WithMasker("email", func(s string) string { return "hidden" })}, fields: []string{"email"}, output: `{"email":"hidden"}`},
+	}
+	for _, tt := range tests {
+		ctx := tt.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		for _, objects := range []bool{false, true} {
+			opts := append([]FormatterOption{initials}, tt.opts...)
+			if objects {
+				opts = append(opts, WithObjects())
+			}
+			o, err := NewFormatter(opts...).FormatContext(ctx, src, tt.fields)
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			buf, _ := json.Marshal(o)
+			if string(buf) != tt.output {
+				t.Errorf("Returned '%s', expected '%s'", string(buf), tt.output)
+			}
+		}
+	}
+}
+
+func TestFormatMaskErrors(t *testing.T) {
+	_, err := NewFormatter().Format(maskCard{}, []string{"holder"})
+	if _, ok := err.(*MaskerError); !ok || err.Error() != "field 'holder' of dynjson.maskCard has unknown masker 'initials'" {
+		t.Errorf("Returned '%v', expected a MaskerError", err)
+	}
+	h := Handler(func(r *http.Request) (interface{}, error) {
+		return maskCard{}, nil
+	}, HandlerFormatter(NewFormatter()), HandlerProblems())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?select=number", nil))
+	if w.Code != http.StatusInternalServerError || w.Body.String() != "Internal Server Error\n" {
+		t.Errorf("Returned %d '%s', expected %d", w.Code, w.Body.String(), http.StatusInternalServerError)
+	}
+	type Item struct {
+		Tags []string `json:"tags" dynjson:"mask=last4"`
+	}
+	_, err = NewFormatter().Format(Item{}, []string{"tags"})
+	if _, ok := err.(*UnsupportedTypeError); !ok {
+		t.Errorf("Returned %v, expected an UnsupportedTypeError", err)
+	}
+}
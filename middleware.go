@@ -0,0 +1,126 @@
+package dynjson
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Middleware returns a middleware filtering the JSON responses of handlers unaware of dynjson,
+// keeping only the fields selected by the request (see ParseRequest, opts being nil for the defaults, and FilterJSON).
+//
+// Successful responses with a JSON content type (application/json or +json suffix), or without content type
+// and a body starting with an object or array, and no content encoding are buffered, filtered and sent
+// with an updated Content-Length.
+// Other responses, or requests without selection, are passed through untouched.
+// Invalid requests are answered with a 400 problem document (see SelectionProblem), without calling the handler.
+func Middleware(opts *ParseOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fields, err := ParseRequest(r, opts)
+			if err != nil {
+				_ = SelectionProblem(err, opts.params()[0], nil).Write(w)
+				return
+			}
+			if len(fields) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			fw := &filterWriter{ResponseWriter: w}
+			next.ServeHTTP(fw, r)
+			fw.close(fields)
+		})
+	}
+}
+
+// filterWriter buffers JSON responses until the handler returns.
+type filterWriter struct {
+	http.ResponseWriter
+	status    int
+	buffering bool
+	// sniffing tells that the response has no content type, JSON being detected from the body.
+	sniffing bool
+	buf      bytes.Buffer
+}
+
+func (w *filterWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	filtered := status >= 200 && status < 300 && status != http.StatusNoContent && w.Header().Get("Content-Encoding") == ""
+	if filtered && w.Header().Get("Content-Type") == "" {
+		w.sniffing = true
+		return
+	}
+	w.buffering = filtered && isJSON(w.Header().Get("Content-Type"))
+	if !w.buffering {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *filterWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.sniffing {
+		w.buf.Write(b)
+		if body := bytes.TrimLeft(w.buf.Bytes(), " \t\r\n"); len(body) > 0 {
+			w.sniff(body[0] == '{' || body[0] == '[')
+		}
+		return len(b), nil
+	}
+	if w.buffering {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// sniff ends the detection of the content type, the body written so far being passed through unless JSON.
+func (w *filterWriter) sniff(isJSON bool) {
+	w.sniffing = false
+	if isJSON {
+		w.Header().Set("Content-Type", "application/json")
+		w.buffering = true
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.buf.WriteTo(w.ResponseWriter)
+}
+
+// Flush implements http.Flusher, flushing only responses that are passed through.
+func (w *filterWriter) Flush() {
+	if w.status == 0 || w.buffering || w.sniffing {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// close writes the filtered buffered response, the original one being written if it is not valid JSON.
+func (w *filterWriter) close(fields []string) {
+	if w.sniffing {
+		w.sniff(false)
+	}
+	if !w.buffering {
+		return
+	}
+	body := w.buf.Bytes()
+	if filtered, err := FilterJSON(body, fields); err == nil {
+		body = filtered
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || (strings.HasPrefix(mt, "application/") && strings.HasSuffix(mt, "+json"))
+}
@@ -0,0 +1,71 @@
+package dynjson
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	legacy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "24")
+			_ = json.NewEncoder(w).Encode(map[string]int{"foo": 1, "bar": 2})
+		case "/error":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"title":"Not Found"}`)
+		case "/untyped":
+			_ = json.NewEncoder(w).Encode([]map[string]int{{"foo": 1, "bar": 2}})
+		case "/untyped-text":
+			_, _ = io.WriteString(w, "foo, bar")
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = io.WriteString(w, `{"foo":1,"bar":2}`)
+		case "/invalid":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, `{"foo":`)
+		}
+	})
+	h := Middleware(nil)(legacy)
+	var tests = []struct {
+		url    string
+		status int
+		body   string
+		length string
+	}{
+		{url: "/json?select=bar", status: http.StatusOK, body: `{"bar":2}` + "\n", length: "10"},
+		{url: "/json", status: http.StatusOK, body: `{"bar":2,"foo":1}` + "\n", length: "24"},
+		{url: "/error?select=bar", status: http.StatusNotFound, body: `{"title":"Not Found"}`},
+		{url: "/untyped?select=bar", status: http.StatusOK, body: `[{"bar":2}]` + "\n", length: "12"},
+		{url: "/untyped-text?select=bar", status: http.StatusOK, body: "foo, bar"},
+		{url: "/text?select=bar", status: http.StatusOK, body: `{"foo":1,"bar":2}`},
+		{url: "/invalid?select=bar", status: http.StatusCreated, body: `{"foo":`, length: "7"},
+		{url: "/json?select=%zz", status: http.StatusBadRequest, body: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid query: invalid URL escape \"%zz\"","errors":[]}` + "\n"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com"+tt.url, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: returned %d, expected %d", tt.url, w.Code, tt.status)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: returned '%s', expected '%s'", tt.url, w.Body.String(), tt.body)
+		}
+		if w.Header().Get("Content-Length") != tt.length {
+			t.Errorf("%s: returned '%s', expected '%s'", tt.url, w.Header().Get("Content-Length"), tt.length)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/json?fields=foo&select=bar", nil)
+	w := httptest.NewRecorder()
+	Middleware(&ParseOptions{Params: []string{"fields"}})(legacy).ServeHTTP(w, r)
+	if w.Body.String() != `{"foo":1}`+"\n" {
+		t.Errorf("Returned '%s', expected '%s'", w.Body.String(), `{"foo":1}`+"\n")
+	}
+}
@@ -0,0 +1,135 @@
+package dynjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// Object is a JSON object whose members are encoded in order.
+//
+// It is returned by formatters created with WithObjects.
+type Object []Member
+
+// Member is a key/value pair of an Object.
+type Member struct {
+	Key   string
+	Value interface{}
+}
+
+// Get returns the value associated with key.
+func (o Object) Get(key string) (interface{}, bool) {
+	for _, m := range o {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// MarshalJSON implements json.Marshaler.
+func (o Object) MarshalJSON() ([]byte, error) {
+	if o == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+var objectType = reflect.TypeOf(Object{})
+
+type member struct {
+	key       string
+	src       []int
+	omitEmpty bool
+	// quoted tells that the value is encoded as a string, as with the string option of json tags.
+	quoted bool
+	format formatter
+}
+
+type objectFormatter struct {
+	members []member
+}
+
+func (f *objectFormatter) typ() reflect.Type {
+	return objectType
+}
+
+func (f *objectFormatter) format(ctx context.Context, src reflect.Value) (reflect.Value, error) {
+	dst := make(Object, 0, len(f.members))
+	for _, m := range f.members {
+		dv, err := m.format.format(ctx, src.FieldByIndex(m.src))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if m.omitEmpty && isEmptyValue(dv) {
+			continue
+		}
+		val := dv.Interface()
+		if m.quoted {
+			val, err = quote(dv)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+		}
+		dst = append(dst, Member{Key: m.key, Value: val})
+	}
+	return reflect.ValueOf(dst), nil
+}
+
+// quote returns the value of v encoded as a string, as the string option of json tags does.
+func quote(v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	s, ok, err := quotedJSON(v)
+	if err != nil || !ok {
+		return v.Interface(), err
+	}
+	return s, nil
+}
+
+// isEmptyValue reports whether v is empty according to the omitempty rules of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	if v.Type() == objectType {
+		// objects stand for structs, which are never empty
+		return v.IsNil()
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package dynjson
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestObjectKeys(t *testing.T) {
+	src := struct {
+		ID    int    `json:"_id"`
+		First string `json:"1st"`
+		Dash  bool   `json:"a-b"`
+		Lower int    `json:"foo"`
+		Upper int    `json:"Foo"`
+	}{ID: 1, First: "first", Dash: true, Lower: 2, Upper: 3}
+	f := NewFormatter(WithObjects())
+	o, err := f.Format(src, []string{"Foo", "a-b", "_id", "1st", "foo"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	buf, err := json.Marshal(o)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	expected := `{"Foo":3,"a-b":true,"_id":1,"1st":"first","foo":2}`
+	if string(buf) != expected {
+		t.Errorf("Returned '%s', expected '%s'", string(buf), expected)
+	}
+	if _, ok := o.(Object); !ok {
+		t.Errorf("Returned %T, expected Object", o)
+	}
+}
+
+func TestObjectEmpty(t *testing.T) {
+	type Inner struct {
+		Bar int `json:"bar,omitempty"`
+	}
+	src := []struct {
+		Foo Inner  `json:"foo,omitempty"`
+		Baz *Inner `json:"baz,omitempty"`
+	}{{}, {Baz: &Inner{Bar: 1}}}
+	f := NewFormatter(WithObjects())
+	o, err := f.Format(src, []string{"foo.bar", "baz.bar"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	buf, err := json.Marshal(o)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	expected := `[{"foo":{}},{"foo":{},"baz":{"bar":1}}]`
+	if string(buf) != expected {
+		t.Errorf("Returned '%s', expected '%s'", string(buf), expected)
+	}
+}
+
+func TestObjectQuoted(t *testing.T) {
+	type Inner struct {
+		Bar int `json:"bar"`
+	}
+	one := 1.5
+	src := struct {
+		D     int      `json:"d,string"`
+		S     string   `json:"s,string"`
+		B     bool     `json:"b,string"`
+		F     *float64 `json:"f,string"`
+		Nil   *int     `json:"nil,string"`
+		Inner Inner    `json:"inner,string"`
+	}{D: 4, S: "<a>", B: true, F: &one, Inner: Inner{Bar: 1}}
+	expected, err := json.Marshal(src)
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	for _, fields := range [][]string{nil, {"d", "s", "b", "f", "nil", "inner"}} {
+		o, err := NewFormatter(WithObjects()).Format(src, fields)
+		if err != nil {
+			t.Fatal("Should not have returned", err)
+		}
+		buf, err := json.Marshal(o)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if string(buf) != string(expected) {
+			t.Errorf("Returned '%s', expected '%s'", string(buf), string(expected))
+		}
+	}
+}
+
+func TestObjectMarshalNil(t *testing.T) {
+	buf, err := json.Marshal(struct{ O Object }{})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if string(buf) != `{"O":null}` {
+		t.Errorf("Returned '%s', expected '%s'", string(buf), `{"O":null}`)
+	}
+}
@@ -0,0 +1,122 @@
+package dynjson
+
+import "reflect"
+
+// FormatterOption defines a NewFormatter option.
+type FormatterOption func(*Formatter)
+
+// WithObjects makes the formatter return Object values instead of synthesized struct values.
+//
+// Objects accept any JSON key, whereas synthesized structs require keys that can be
+// turned into exported Go field names, and are never garbage collected.
+func WithObjects() FormatterOption {
+	return func(f *Formatter) {
+		f.objects = true
+	}
+}
+
+// WithParallelism makes the formatter split slices of at least threshold elements
+// across a pool of workers goroutines, shared by all the calls to the formatter.
+//
+// The order of the elements is kept, and the error of the first failing element is returned.
+// Slices are formatted sequentially when their elements are counted by the MaxElements output limit.
+func WithParallelism(threshold, workers int) FormatterOption {
+	return func(f *Formatter) {
+		if workers < 2 {
+			f.pool = nil
+			return
+		}
+		f.pool = newWorkerPool(threshold, workers)
+	}
+}
+
+// WithLenient makes the formatter ignore unknown fields instead of returning an error.
+//
+// The ignored paths can be collected with the WithReport option.
+func WithLenient() FormatterOption {
+	return func(f *Formatter) {
+		f.lenient = true
+	}
+}
+
+// Limits bounds the complexity of the selections accepted by a formatter, zero values meaning no limit.
+type Limits struct {
+	// MaxFields is the maximum number of selected fields. It also bounds the number of leaf fields
+	// non empty selections expand to, parent fields selecting their whole subtree.
+	MaxFields int `json:"maxFields,omitempty"`
+	// MaxDepth is the maximum number of segments of a field (foo.bar has 2).
+	MaxDepth int `json:"maxDepth,omitempty"`
+	// MaxLength is the maximum total length of the fields, comma separated.
+	MaxLength int `json:"maxLength,omitempty"`
+}
+
+// WithLimits makes the formatter reject selections exceeding limits with a LimitError,
+// before compiling or caching them (once compiled, before caching, for the expanded fields).
+func WithLimits(limits Limits) FormatterOption {
+	return func(f *Formatter) {
+		f.limits = limits
+	}
+}
+
+// WithFieldCost sets the cost of a field of the struct type T, overriding its dynjson:"cost=N" tag.
+//
+// The cost of a selection is the sum of the costs of the fields it outputs (1 by default), used by WithBudget:
+// selecting a struct, or no fields, outputs all the fields under it.
+func WithFieldCost[T any](field string, cost int) FormatterOption {
+	return func(f *Formatter) {
+		t := reflect.TypeOf((*T)(nil)).Elem()
+		if f.costs[t] == nil {
+			f.costs[t] = map[string]int{}
+		}
+		f.costs[t][field] = cost
+	}
+}
+
+// WithSliceMultiplier multiplies the cost of the fields of slice elements by n (1 by default),
+// as an estimate of the number of elements.
+func WithSliceMultiplier(n int) FormatterOption {
+	return func(f *Formatter) {
+		f.sliceMul = n
+	}
+}
+
+// WithBudget makes the formatter reject selections costing more than max with a LimitError.
+func WithBudget(max int) FormatterOption {
+	return func(f *Formatter) {
+		f.budget = max
+	}
+}
+
+// FormatOption defines a Formatter.Format option.
+type FormatOption func(*formatOptions)
+
+type formatOptions struct {
+	lenient bool
+	report  *Report
+}
+
+// Lenient makes the call ignore unknown fields instead of returning an error (see WithLenient).
+func Lenient() FormatOption {
+	return func(o *formatOptions) {
+		o.lenient = true
+	}
+}
+
+// WithReport makes the call fill r.
+func WithReport(r *Report) FormatOption {
+	return func(o *formatOptions) {
+		o.report = r
+	}
+}
+
+// Report holds information about a formatting call.
+type Report struct {
+	// Ignored are the unknown paths ignored in lenient mode.
+	Ignored []string
+	// Denied are the paths dropped by the Authorizer (see DropForbidden).
+	Denied []string
+	// Truncated tells whether slice elements (or stream items) have been dropped (see TruncateOverflow).
+	Truncated bool
+	// Cost is the cost of the selection (see WithFieldCost).
+	Cost int
+}
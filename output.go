@@ -0,0 +1,194 @@
+package dynjson
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// OutputLimits bounds the size of the output of a formatter, zero values meaning no limit.
+type OutputLimits struct {
+	// MaxElements is the maximum number of slice elements of a formatted value, nested ones included.
+	MaxElements int
+	// MaxSliceLength is the maximum number of elements of each formatted slice.
+	MaxSliceLength int
+	// MaxBytes is the maximum number of bytes written by an encoder.
+	MaxBytes int
+}
+
+// OverflowPolicy defines what happens to the output exceeding OutputLimits.
+type OverflowPolicy int
+
+const (
+	// FailOverflow makes the formatting fail with an OutputLimitError.
+	FailOverflow OverflowPolicy = iota
+	// TruncateOverflow drops the last slice elements (or stream items), as told by Report.Truncated,
+	// and by the TruncatedHeader of responses.
+	TruncateOverflow
+)
+
+// WithOutputLimits makes the formatter bound its output, overflows being handled according to policy.
+//
+// Element limits apply to slices of structs. Encoded documents exceeding MaxBytes cannot be truncated
+// while staying valid, so that encoders fail regardless of the policy, except streams (see EncodeStream)
+// which stop before the first item exceeding it.
+func WithOutputLimits(limits OutputLimits, policy OverflowPolicy) FormatterOption {
+	return func(f *Formatter) {
+		f.output = limits
+		f.truncate = policy == TruncateOverflow
+	}
+}
+
+// TruncatedHeader is the header set to "true" by Respond and Handler when the output has been truncated.
+const TruncatedHeader = "X-Dynjson-Truncated"
+
+// OutputLimitError is returned when the output exceeds the OutputLimits of the formatter.
+type OutputLimitError struct {
+	// Limit is either "element count", "slice length" or "size".
+	Limit string
+	Max   int
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("output %s exceeds the limit (%d)", e.Limit, e.Max)
+}
+
+// outputConfig holds the element limits applied by slice formatters.
+type outputConfig struct {
+	limits   OutputLimits
+	truncate bool
+}
+
+// outputState counts the elements of a formatting call.
+type outputState struct {
+	// remaining is the number of elements that can still be formatted.
+	remaining int64
+	truncated int32
+}
+
+type outputKey struct{}
+
+// truncationKey is the context key of the flag set when the output of a response or stream is truncated.
+type truncationKey struct{}
+
+// withTruncationFlag returns ctx holding a flag set when the output is truncated.
+func withTruncationFlag(ctx context.Context) (context.Context, *int32) {
+	flag := new(int32)
+	return context.WithValue(ctx, truncationKey{}, flag), flag
+}
+
+// flagTruncation sets the truncation flag of ctx, if any.
+func flagTruncation(ctx context.Context) {
+	if flag, ok := ctx.Value(truncationKey{}).(*int32); ok {
+		atomic.StoreInt32(flag, 1)
+	}
+}
+
+// limitsElements reports whether l limits slice elements.
+func (l OutputLimits) limitsElements() bool {
+	return l.MaxElements > 0 || l.MaxSliceLength > 0
+}
+
+// elementLimits returns the element limits applied by slice formatters, or nil if none.
+func (f *Formatter) elementLimits() *outputConfig {
+	if !f.output.limitsElements() {
+		return nil
+	}
+	return &outputConfig{limits: f.output, truncate: f.truncate}
+}
+
+// outputContext returns ctx holding the element count of a formatting call, if limited.
+func (f *Formatter) outputContext(ctx context.Context) (context.Context, *outputState) {
+	if !f.output.limitsElements() {
+		return ctx, nil
+	}
+	s := &outputState{remaining: int64(f.output.MaxElements)}
+	return context.WithValue(ctx, outputKey{}, s), s
+}
+
+// wasTruncated reports whether elements have been dropped.
+func (s *outputState) wasTruncated() bool {
+	return s != nil && atomic.LoadInt32(&s.truncated) != 0
+}
+
+func (s *outputState) markTruncated() {
+	if s != nil {
+		atomic.StoreInt32(&s.truncated, 1)
+	}
+}
+
+// take takes up to n of the remaining elements, returning their number.
+func (s *outputState) take(n int) int {
+	for {
+		remaining := atomic.LoadInt64(&s.remaining)
+		taken := int64(n)
+		if taken > remaining {
+			taken = remaining
+		}
+		if atomic.CompareAndSwapInt64(&s.remaining, remaining, remaining-taken) {
+			return int(taken)
+		}
+	}
+}
+
+// limit returns the number of the n elements of a slice to format.
+func (o *outputConfig) limit(ctx context.Context, n int) (int, error) {
+	s, _ := ctx.Value(outputKey{}).(*outputState)
+	if max := o.limits.MaxSliceLength; max > 0 && n > max {
+		if !o.truncate {
+			return 0, &OutputLimitError{Limit: "slice length", Max: max}
+		}
+		n = max
+		s.markTruncated()
+		flagTruncation(ctx)
+	}
+	if o.limits.MaxElements > 0 && s != nil {
+		if taken := s.take(n); taken < n {
+			if !o.truncate {
+				return 0, &OutputLimitError{Limit: "element count", Max: o.limits.MaxElements}
+			}
+			n = taken
+			s.markTruncated()
+			flagTruncation(ctx)
+		}
+	}
+	return n, nil
+}
+
+// limitWriter fails writes exceeding max bytes in total, without writing them.
+type limitWriter struct {
+	w   io.Writer
+	max int
+	n   int
+	// reserve is the number of bytes kept for the end of the output.
+	reserve int
+}
+
+// limitedWriter returns w, bounded by the MaxBytes limit of f.
+func (f *Formatter) limitedWriter(w io.Writer) io.Writer {
+	if f.output.MaxBytes <= 0 {
+		return w
+	}
+	return &limitWriter{w: w, max: f.output.MaxBytes}
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.n+len(p)+w.reserve > w.max {
+		return 0, &OutputLimitError{Limit: "size", Max: w.max}
+	}
+	n, err := w.w.Write(p)
+	w.n += n
+	return n, err
+}
+
+// truncated reports whether err tells that items exceeding the limits must be dropped, instead of failing.
+func (f *Formatter) truncated(err error) bool {
+	_, ok := err.(*OutputLimitError)
+	return ok && f.truncate
+}
+
+// Flush flushes the underlying writer, for streams.
+func (w *limitWriter) Flush() error {
+	return flush(w.w)
+}
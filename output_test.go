@@ -0,0 +1,178 @@
+package dynjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+type outputLine struct {
+	SKU string `json:"sku"`
+}
+
+type outputOrder struct {
+	ID    int          `json:"id"`
+	Lines []outputLine `json:"lines"`
+}
+
+func TestFormatOutputLimits(t *testing.T) {
+	src := []outputOrder{
+		{ID: 1, Lines: []outputLine{{SKU: "a"}, {SKU: "b"}, {SKU: "c"}}},
+		{ID: 2, Lines: []outputLine{{SKU: "d"}}},
+	}
+	var tests = []struct {
+		limits    OutputLimits
+		policy    OverflowPolicy
+		fields    []string
+		output    string
+		err       string
+		truncated bool
+	}{
+		{limits: OutputLimits{MaxElements: 6}, fields: []string{"id", "lines.sku"}, output: `[{"id":1,"lines":[{"sku":"a"},{"sku":"b"},{"sku":"c"}]},{"id":2,"lines":[{"sku":"d"}]}]`},
+		{limits: OutputLimits{MaxElements: 5}, fields: []string{"id", "lines.sku"}, err: "output element count exceeds the limit (5)"},
+		{limits: OutputLimits{MaxElements: 4}, policy: TruncateOverflow, fields: []string{"id", "lines.sku"}, output: `[{"id":1,"lines":[{"sku":"a"},{"sku":"b"}]},{"id":2,"lines":[]}]`, truncated: true},
+		{limits: OutputLimits{MaxSliceLength: 2}, fields: []string{"lines"}, err: "output slice length exceeds the limit (2)"},
+		{limits: OutputLimits{MaxSliceLength: 2}, policy: TruncateOverflow, fields: []string{"lines"}, output: `[{"lines":[{"sku":"a"},{"sku":"b"}]},{"lines":[{"sku":"d"}]}]`, truncated: true},
+		{limits: OutputLimits{MaxSliceLength: 2}, policy: TruncateOverflow, output: `[{"id":1,"lines":[{"sku":"a"},{"sku":"b"}]},{"id":2,"lines":[{"sku":"d"}]}]`, truncated: true},
+		{limits: OutputLimits{MaxSliceLength: 3}, output: `[{"id":1,"lines":[{"sku":"a"},{"sku":"b"},{"sku":"c"}]},{"id":2,"lines":[{"sku":"d"}]}]`},
+	}
+	for _, tt := range tests {
+		for _, f := range []*Formatter{NewFormatter(WithOutputLimits(tt.limits, tt.policy)), NewFormatter(WithOutputLimits(tt.limits, tt.policy), WithObjects())} {
+			var report Report
+			o, err := f.Format(src, tt.fields, WithReport(&report))
+			if tt.err != "" {
+				if _, ok := err.(*OutputLimitError); !ok || err.Error() != tt.err {
+					t.Errorf("Returned '%v', expected '%s'", err, tt.err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal("Should not have returned", err)
+			}
+			buf, _ := json.Marshal(o)
+			if string(buf) != tt.output {
+				t.Errorf("Returned '%s', expected '%s'", string(buf), tt.output)
+			}
+			if report.Truncated != tt.truncated {
+				t.Errorf("Returned %v, expected %v", report.Truncated, tt.truncated)
+			}
+		}
+	}
+}
+
+func TestFormatOutputLimitsParallel(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	src := make([]outputOrder, 64)
+	for i := range src {
+		src[i] = outputOrder{ID: i, Lines: []outputLine{{SKU: "a"}, {SKU: "b"}, {SKU: "c"}}}
+	}
+	f := NewFormatter(WithOutputLimits(OutputLimits{MaxElements: 150}, TruncateOverflow), WithParallelism(2, 4))
+	var expected string
+	for i := 0; i < 50; i++ {
+		o, err := f.Format(src, []string{"id", "lines.sku"})
+		if err != nil {
+			t.Fatal("Should not have returned", err)
+		}
+		buf, _ := json.Marshal(o)
+		if i == 0 {
+			expected = string(buf)
+			continue
+		}
+		if string(buf) != expected {
+			t.Fatalf("Returned '%s', expected '%s'", string(buf), expected)
+		}
+	}
+}
+
+func TestEncodeOutputBytes(t *testing.T) {
+	src := []outputOrder{{ID: 1}, {ID: 2}, {ID: 3}}
+	var buf bytes.Buffer
+	f := NewFormatter(WithOutputLimits(OutputLimits{MaxBytes: 20}, TruncateOverflow))
+	err := f.Encode(&buf, src, []string{"id"})
+	if _, ok := err.(*OutputLimitError); !ok {
+		t.Errorf("Returned %v, expected an OutputLimitError", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Returned '%s', expected nothing", buf.String())
+	}
+	var tests = []struct {
+		opts   []StreamOption
+		output string
+	}{
+		{output: `[{"id":1},{"id":2}]` + "\n"},
+		{opts: []StreamOption{StreamNDJSON()}, output: `{"id":1}` + "\n" + `{"id":2}` + "\n"},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		var report Report
+		err = EncodeStream(&buf, sliceNext(src), []string{"id"}, append(tt.opts, StreamFormatter(f), StreamReport(&report))...)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if buf.String() != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", buf.String(), tt.output)
+		}
+		if !report.Truncated {
+			t.Error("Expected the stream to be reported as truncated")
+		}
+	}
+	buf.Reset()
+	f = NewFormatter(WithOutputLimits(OutputLimits{MaxBytes: 20}, FailOverflow))
+	err = EncodeStream(&buf, sliceNext(src), []string{"id"}, StreamFormatter(f))
+	if _, ok := err.(*OutputLimitError); !ok {
+		t.Errorf("Returned %v, expected an OutputLimitError", err)
+	}
+}
+
+func TestRespondTruncated(t *testing.T) {
+	src := []outputOrder{{ID: 1}, {ID: 2}, {ID: 3}}
+	var tests = []struct {
+		limits    OutputLimits
+		accept    string
+		body      string
+		truncated string
+	}{
+		{limits: OutputLimits{MaxSliceLength: 3}, body: `[{"id":1},{"id":2},{"id":3}]` + "\n"},
+		{limits: OutputLimits{MaxSliceLength: 2}, body: `[{"id":1},{"id":2}]` + "\n", truncated: "true"},
+		{limits: OutputLimits{MaxBytes: 20}, accept: "application/x-ndjson", body: `{"id":1}` + "\n" + `{"id":2}` + "\n", truncated: "true"},
+		{limits: OutputLimits{MaxElements: 1}, accept: "text/csv", body: "id\n1\n", truncated: "true"},
+	}
+	for _, tt := range tests {
+		f := NewFormatter(WithOutputLimits(tt.limits, TruncateOverflow))
+		for _, h := range []http.Handler{
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = f.Respond(w, r, src, nil)
+			}),
+			Handler(func(r *http.Request) (interface{}, error) {
+				return src, nil
+			}, HandlerFormatter(f)),
+		} {
+			r := httptest.NewRequest(http.MethodGet, "/?select=id", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Body.String() != tt.body {
+				t.Errorf("Returned '%s', expected '%s'", w.Body.String(), tt.body)
+			}
+			if w.Header().Get(TruncatedHeader) != tt.truncated {
+				t.Errorf("Returned '%s', expected '%s'", w.Header().Get(TruncatedHeader), tt.truncated)
+			}
+		}
+	}
+}
+
+func sliceNext[T any](s []T) func() (T, bool, error) {
+	return func() (T, bool, error) {
+		var v T
+		if len(s) == 0 {
+			return v, false, nil
+		}
+		v, s = s[0], s[1:]
+		return v, true, nil
+	}
+}
@@ -1,6 +1,7 @@
 package dynjson
 
 import (
+	"context"
 	"reflect"
 )
 
@@ -12,14 +13,19 @@ type pointerFormatter struct {
 func (f *pointerFormatter) typ() reflect.Type {
 	return f.t
 }
-func (f *pointerFormatter) format(src reflect.Value) (reflect.Value, error) {
+func (f *pointerFormatter) format(ctx context.Context, src reflect.Value) (reflect.Value, error) {
 	if src.IsNil() {
 		return reflect.Zero(f.t), nil
 	}
-	dst, err := f.elem.format(src.Elem())
+	dst, err := f.elem.format(ctx, src.Elem())
 	if err != nil {
 		return dst, err
 	}
+	if !dst.CanAddr() {
+		pdst := reflect.New(dst.Type())
+		pdst.Elem().Set(dst)
+		return pdst, nil
+	}
 	return dst.Addr(), nil
 }
 
@@ -28,16 +34,16 @@ type pointerBuilder struct {
 	elem *structBuilder
 }
 
-func (b *pointerBuilder) build(fields []string, prefix string) (formatter, error) {
-	ef, err := b.elem.build(fields, prefix)
+func (b *pointerBuilder) build(c *compilation, fields []string, prefix string) (formatter, error) {
+	ef, err := b.elem.build(c, fields, prefix)
 	if err != nil {
 		return nil, err
 	}
 	return &pointerFormatter{t: reflect.PtrTo(ef.typ()), elem: ef}, nil
 }
 
-func makePointerBuilder(t reflect.Type) (*pointerBuilder, error) {
-	eb, err := makeStructBuilder(t.Elem())
+func makePointerBuilder(t reflect.Type, building map[reflect.Type]bool) (*pointerBuilder, error) {
+	eb, err := makeStructBuilder(t.Elem(), building)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,249 @@
+package dynjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Policy lists the selections allowed per route, as loaded from a JSON policy file:
+//
+//	{
+//	  "routes": {
+//	    "GET /orders": {
+//	      "type": "Order",
+//	      "allowed": ["id", "total", "customer.name", "items"],
+//	      "default": ["id", "total"],
+//	      "presets": {"summary": ["id", "customer.name"]},
+//	      "limits": {"maxFields": 20, "maxDepth": 3}
+//	    }
+//	  }
+//	}
+type Policy struct {
+	Routes map[string]*RoutePolicy `json:"routes"`
+}
+
+// RoutePolicy defines the selections allowed for a route.
+type RoutePolicy struct {
+	// Type is the name of the Go type of the values returned by the route, or of their elements for slices.
+	Type string `json:"type"`
+	// Allowed are the fields that can be selected, along with their subfields. All the fields are allowed if empty.
+	Allowed []string `json:"allowed,omitempty"`
+	// Default is the selection of requests selecting no fields, Allowed if empty.
+	Default []string `json:"default,omitempty"`
+	// Presets are named selections, selected by their name as if it were a field.
+	Presets map[string][]string `json:"presets,omitempty"`
+	// Limits bounds the selections of the route, presets being expanded.
+	Limits Limits `json:"limits"`
+}
+
+// ParsePolicy reads a JSON policy from r, validated against types, values (or pointers to values) of the
+// types named in the policy by their Go name. Unknown types and fields are reported as errors.
+func ParsePolicy(r io.Reader, types ...interface{}) (*Policy, error) {
+	named := map[string]reflect.Type{}
+	for _, v := range types {
+		t := reflect.TypeOf(v)
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if other, found := named[t.Name()]; found && other != t {
+			return nil, fmt.Errorf("policy: types %s and %s have the same name", other, t)
+		}
+		named[t.Name()] = t
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("policy: %w", err)
+	}
+	routes := make([]string, 0, len(p.Routes))
+	for route := range p.Routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		if err := p.Routes[route].validate(named); err != nil {
+			return nil, fmt.Errorf("policy: route '%s': %w", route, err)
+		}
+	}
+	return &p, nil
+}
+
+// LoadPolicy reads a JSON policy file (see ParsePolicy).
+func LoadPolicy(path string, types ...interface{}) (*Policy, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParsePolicy(file, types...)
+}
+
+// validate checks the fields of rp against the named types.
+func (rp *RoutePolicy) validate(named map[string]reflect.Type) error {
+	if rp == nil {
+		return fmt.Errorf("no policy")
+	}
+	t := named[rp.Type]
+	if t == nil {
+		return fmt.Errorf("unknown type '%s'", rp.Type)
+	}
+	// a formatter of its own keeps the cache of the formatters using the policy clean
+	f := NewFormatter()
+	check := func(fields []string) error {
+		if len(fields) == 0 {
+			return nil
+		}
+		_, err := f.compile(context.Background(), t, fields)
+		return err
+	}
+	if err := check(rp.Allowed); err != nil {
+		return fmt.Errorf("allowed: %w", err)
+	}
+	if err := check(rp.Default); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	if err := rp.checkAllowed(rp.Default); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	names := make([]string, 0, len(rp.Presets))
+	for name := range rp.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := f.compile(context.Background(), t, []string{name}); err == nil {
+			return fmt.Errorf("preset '%s': conflicts with a field", name)
+		}
+		if err := check(rp.Presets[name]); err != nil {
+			return fmt.Errorf("preset '%s': %w", name, err)
+		}
+		if err := rp.checkAllowed(rp.Presets[name]); err != nil {
+			return fmt.Errorf("preset '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkAllowed returns a ForbiddenFieldError if a field is not allowed.
+func (rp *RoutePolicy) checkAllowed(fields []string) error {
+	if len(rp.Allowed) == 0 {
+		return nil
+	}
+	for _, field := range fields {
+		if !selectsAny(field, rp.Allowed) {
+			return &ForbiddenFieldError{Path: field}
+		}
+	}
+	return nil
+}
+
+// Select returns the fields selected by the request fields of route: the default ones if none,
+// presets being expanded. A ForbiddenFieldError is returned for fields that are not allowed,
+// and a LimitError for selections exceeding the limits of the route.
+//
+// The fields of routes missing from the policy are returned as is.
+func (p *Policy) Select(route string, fields []string) ([]string, error) {
+	rp := p.Routes[route]
+	if rp == nil {
+		return fields, nil
+	}
+	if len(fields) == 0 {
+		if len(rp.Default) > 0 {
+			return rp.Default, nil
+		}
+		return rp.Allowed, nil
+	}
+	var selected []string
+	for _, field := range fields {
+		if preset, found := rp.Presets[field]; found {
+			selected = append(selected, preset...)
+		} else {
+			selected = append(selected, field)
+		}
+	}
+	if err := rp.Limits.check(selected); err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, field := range selected {
+		if err := rp.checkAllowed([]string{field}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := joinErrors(errs); err != nil {
+		return nil, err
+	}
+	return selected, nil
+}
+
+// WithPolicy makes the formatter restrict the selections of routes to p (see Formatter.SelectRoute).
+func WithPolicy(p *Policy) FormatterOption {
+	return func(f *Formatter) {
+		f.policy = p
+	}
+}
+
+// SetPolicy replaces the policy of the formatter, e.g. when its file changes.
+func (f *Formatter) SetPolicy(p *Policy) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.policy = p
+}
+
+// SelectRoute returns the fields selected by the request fields of route, according to the policy
+// of the formatter (see Policy.Select), or fields if it has none.
+func (f *Formatter) SelectRoute(route string, fields []string) ([]string, error) {
+	f.mu.Lock()
+	p := f.policy
+	f.mu.Unlock()
+	if p == nil {
+		return fields, nil
+	}
+	return p.Select(route, fields)
+}
+
+// WatchPolicy checks the policy file at path every interval until ctx is done, loading it into the formatter
+// after the first interval and when it changes (see LoadPolicy). Invalid policies are passed to onError, if not nil,
+// the current policy being kept.
+//
+// It returns the error of ctx, and is meant to be run in its own goroutine once the policy has been loaded.
+func (f *Formatter) WatchPolicy(ctx context.Context, path string, interval time.Duration, onError func(error), types ...interface{}) error {
+	var info os.FileInfo
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		last := info
+		var err error
+		info, err = os.Stat(path)
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			info = last
+			continue
+		}
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		p, err := LoadPolicy(path, types...)
+		if err != nil {
+			if onError != nil {
+				onError(err)
+			}
+			continue
+		}
+		f.SetPolicy(p)
+	}
+}
@@ -0,0 +1,182 @@
+package dynjson
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type policyCustomer struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type policyOrder struct {
+	ID       int            `json:"id"`
+	Total    float64        `json:"total"`
+	Customer policyCustomer `json:"customer"`
+}
+
+const testPolicy = `{
+	"routes": {
+		"GET /orders": {
+			"type": "policyOrder",
+			"allowed": ["id", "total", "customer.name"],
+			"default": ["id", "total"],
+			"presets": {"summary": ["id", "customer.name"]},
+			"limits": {"maxFields": 3}
+		}
+	}
+}`
+
+func TestPolicySelect(t *testing.T) {
+	p, err := ParsePolicy(strings.NewReader(testPolicy), policyOrder{})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	var tests = []struct {
+		route  string
+		fields []string
+		output string
+		err    string
+	}{
+		{route: "GET /orders", output: "id,total"},
+		{route: "GET /orders", fields: []string{"total", "customer.name"}, output: "total,customer.name"},
+		{route: "GET /orders", fields: []string{"summary", "total"}, output: "id,customer.name,total"},
+		{route: "GET /orders", fields: []string{"customer"}, err: "field 'customer' is forbidden"},
+		{route: "GET /orders", fields: []string{"id", "customer.email"}, err: "field 'customer.email' is forbidden"},
+		{route: "GET /orders", fields: []string{"summary", "total", "id"}, err: "selection fields (4) exceeds the limit (3)"},
+		{route: "GET /customers", fields: []string{"email"}, output: "email"},
+	}
+	for _, tt := range tests {
+		fields, err := p.Select(tt.route, tt.fields)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Returned '%v', expected '%s'", err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if strings.Join(fields, ",") != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", strings.Join(fields, ","), tt.output)
+		}
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	var tests = []struct {
+		policy string
+		err    string
+	}{
+		{policy: `{"routes": {"a": {"type": "Order"}}}`, err: "policy: route 'a': unknown type 'Order'"},
+		{policy: `{"routes": {"a": {"type": "policyOrder", "allowed": ["id", "nmae"]}}}`, err: "policy: route 'a': allowed: field 'nmae' does not exist"},
+		{policy: `{"routes": {"a": {"type": "policyOrder", "allowed": ["id"], "default": ["total"]}}}`, err: "policy: route 'a': default: field 'total' is forbidden"},
+		{policy: `{"routes": {"a": {"type": "policyOrder", "presets": {"total": ["id"]}}}}`, err: "policy: route 'a': preset 'total': conflicts with a field"},
+		{policy: `{"routes": {"a": {"type": "policyOrder", "presets": {"p": ["customer.nme"]}}}}`, err: "policy: route 'a': preset 'p': field 'customer.nme' does not exist, did you mean 'name'?"},
+		{policy: `{"routes": {"a": {"type": "policyOrder", "allow": ["id"]}}}`, err: `policy: json: unknown field "allow"`},
+	}
+	for _, tt := range tests {
+		_, err := ParsePolicy(strings.NewReader(tt.policy), &policyOrder{})
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("Returned '%v', expected '%s'", err, tt.err)
+		}
+	}
+}
+
+func TestHandlerRoute(t *testing.T) {
+	p, err := ParsePolicy(strings.NewReader(testPolicy), policyOrder{})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	h := Handler(func(r *http.Request) (interface{}, error) {
+		return []policyOrder{{ID: 1, Total: 12.5, Customer: policyCustomer{Name: "Jane", Email: "jane@example.com"}}}, nil
+	}, HandlerFormatter(NewFormatter(WithPolicy(p))), HandlerRoute("GET /orders"))
+	var tests = []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{url: "/orders", status: http.StatusOK, body: `[{"id":1,"total":12.5}]` + "\n"},
+		{url: "/orders?select=summary", status: http.StatusOK, body: `[{"id":1,"customer":{"name":"Jane"}}]` + "\n"},
+		{url: "/orders?select=customer.email", status: http.StatusForbidden, body: "field 'customer.email' is forbidden\n"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com"+tt.url, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("Returned %d, expected %d", w.Code, tt.status)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("Returned '%s', expected '%s'", w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestWatchPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := os.WriteFile(path, []byte(testPolicy), 0o644)
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	p, err := LoadPolicy(path, policyOrder{})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	f := NewFormatter(WithPolicy(p))
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 10)
+	done := make(chan error)
+	go func() {
+		done <- f.WatchPolicy(ctx, path, 10*time.Millisecond, func(err error) { errs <- err }, policyOrder{})
+	}()
+	// the modification time must change, whatever the resolution of the file system
+	modified := time.Now().Add(time.Second)
+	err = os.WriteFile(path, []byte(strings.Replace(testPolicy, `"default": ["id", "total"]`, `"default": ["total"]`, 1)), 0o644)
+	if err == nil {
+		err = os.Chtimes(path, modified, modified)
+	}
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if fields, _ := f.SelectRoute("GET /orders", nil); strings.Join(fields, ",") == "total" {
+			break
+		}
+	}
+	fields, _ := f.SelectRoute("GET /orders", nil)
+	if strings.Join(fields, ",") != "total" {
+		t.Errorf("Returned '%s', expected '%s'", strings.Join(fields, ","), "total")
+	}
+	modified = modified.Add(time.Second)
+	err = os.WriteFile(path, []byte(`{"routes": {"GET /orders": {"type": "Order"}}}`), 0o644)
+	if err == nil {
+		err = os.Chtimes(path, modified, modified)
+	}
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	select {
+	case err := <-errs:
+		if err.Error() != "policy: route 'GET /orders': unknown type 'Order'" {
+			t.Errorf("Returned '%s', expected an unknown type error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected error but returned nil")
+	}
+	fields, _ = f.SelectRoute("GET /orders", nil)
+	if strings.Join(fields, ",") != "total" {
+		t.Errorf("Returned '%s', expected '%s'", strings.Join(fields, ","), "total")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Returned %v, expected %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,54 @@
+package dynjson
+
+import "sync"
+
+// workerPool bounds the number of goroutines used to format slices in parallel.
+type workerPool struct {
+	threshold int
+	workers   int
+	sem       chan struct{}
+}
+
+func newWorkerPool(threshold, workers int) *workerPool {
+	return &workerPool{
+		threshold: threshold,
+		workers:   workers,
+		sem:       make(chan struct{}, workers),
+	}
+}
+
+// run splits [0,n) into chunks processed by fn, in the pool when a worker is available
+// or in the calling goroutine otherwise, and returns the error of the first failing chunk.
+func (p *workerPool) run(n int, fn func(start, end int) error) error {
+	size := (n + p.workers - 1) / p.workers
+	errs := make([]error, 0, p.workers)
+	var wg sync.WaitGroup
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		errs = append(errs, nil)
+		err := &errs[len(errs)-1]
+		select {
+		case p.sem <- struct{}{}:
+			wg.Add(1)
+			go func(start, end int) {
+				defer func() {
+					<-p.sem
+					wg.Done()
+				}()
+				*err = fn(start, end)
+			}(start, end)
+		default:
+			*err = fn(start, end)
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package dynjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestFormatParallel(t *testing.T) {
+	type Item struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}
+	type Result struct {
+		Items []Item `json:"items"`
+	}
+	src := make([]Result, 100)
+	for i := range src {
+		src[i].Items = make([]Item, i)
+		for j := range src[i].Items {
+			src[i].Items[j] = Item{Foo: j, Bar: fmt.Sprint(i)}
+		}
+	}
+	expected, err := NewFormatter().Format(src, []string{"items.bar"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	expectedBuf, _ := json.Marshal(expected)
+	f := NewFormatter(WithParallelism(10, 4))
+	o, err := f.Format(src, []string{"items.bar"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	buf, _ := json.Marshal(o)
+	if string(buf) != string(expectedBuf) {
+		t.Errorf("Returned '%s', expected '%s'", string(buf), string(expectedBuf))
+	}
+}
+
+func TestWorkerPoolFirstError(t *testing.T) {
+	p := newWorkerPool(1, 4)
+	for i := 0; i < 10; i++ {
+		err := p.run(100, func(start, end int) error {
+			if start >= 50 {
+				return fmt.Errorf("error at %d", start)
+			}
+			return nil
+		})
+		if err == nil || err.Error() != "error at 50" {
+			t.Errorf("Returned '%v', expected '%s'", err, "error at 50")
+		}
+	}
+	err := p.run(10, func(start, end int) error {
+		return nil
+	})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	err = p.run(3, func(start, end int) error {
+		return errors.New("error")
+	})
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+}
@@ -1,8 +1,9 @@
 package dynjson
 
 import (
-	"fmt"
+	"context"
 	"reflect"
+	"strings"
 )
 
 type primitiveFormatter struct {
@@ -13,7 +14,7 @@ func (f *primitiveFormatter) typ() reflect.Type {
 	return f.t
 }
 
-func (f *primitiveFormatter) format(src reflect.Value) (reflect.Value, error) {
+func (f *primitiveFormatter) format(ctx context.Context, src reflect.Value) (reflect.Value, error) {
 	return src, nil
 }
 
@@ -21,9 +22,17 @@ type primitiveBuilder struct {
 	t reflect.Type
 }
 
-func (b *primitiveBuilder) build(fields []string, prefix string) (formatter, error) {
+func (b *primitiveBuilder) build(c *compilation, fields []string, prefix string) (formatter, error) {
 	if len(fields) > 0 {
-		return nil, fmt.Errorf("field '%s' does not exist", prefix+fields[0])
+		if !c.lenient {
+			return nil, &UnknownFieldError{Path: prefix + fields[0]}
+		}
+		for _, field := range fields {
+			c.ignored = append(c.ignored, prefix+field)
+		}
+	}
+	if prefix != "" && !isEncodable(b.t) {
+		return nil, &UnsupportedTypeError{Path: strings.TrimSuffix(prefix, "."), Type: b.t}
 	}
 	return &primitiveFormatter{t: b.t}, nil
 }
@@ -31,3 +40,19 @@ func (b *primitiveBuilder) build(fields []string, prefix string) (formatter, err
 func makePrimitiveBuilder(t reflect.Type) (*primitiveBuilder, error) {
 	return &primitiveBuilder{t: t}, nil
 }
+
+// isEncodable reports whether values of type t can be encoded in JSON.
+func isEncodable(t reflect.Type) bool {
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return false
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return isEncodable(t.Elem())
+	case reflect.Map:
+		return isEncodable(t.Elem())
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package dynjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Problem is a RFC 7807 problem details document describing an invalid selection.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// Errors are the problems of the selection, one per path.
+	Errors []ProblemField `json:"errors"`
+}
+
+// ProblemField describes a problem of a selected field.
+type ProblemField struct {
+	// Path is the dot separated path of the field.
+	Path string `json:"path"`
+	// Reason is either unknown_field, duplicate_field, unsupported_type or forbidden_field.
+	Reason string `json:"reason"`
+	// Available are the fields that can be selected instead, for unknown fields.
+	Available []string `json:"available,omitempty"`
+	// Suggestions are the available fields with a name close to the unknown one.
+	Suggestions []string `json:"suggestions,omitempty"`
+	// Pointer locates the field in the query parameter, as param[index], index being
+	// the position of the field among the (comma separated or repeated) values of param.
+	Pointer string `json:"pointer,omitempty"`
+}
+
+// Reasons of ProblemField.
+const (
+	ReasonUnknownField    = "unknown_field"
+	ReasonDuplicateField  = "duplicate_field"
+	ReasonUnsupportedType = "unsupported_type"
+	ReasonForbiddenField  = "forbidden_field"
+)
+
+// SelectionProblem returns the problem document describing err, or nil if err is not a selection error
+// (or a RequestError).
+//
+// param and fields are the name of the query parameter holding the selection and the selected fields,
+// used to locate the invalid fields (param may be empty).
+func SelectionProblem(err error, param string, fields []string) *Problem {
+	var errs []error
+	switch err := err.(type) {
+	case *SelectionError:
+		errs = err.Errors
+	case *UnknownFieldError, *DuplicateFieldError, *UnsupportedTypeError, *ForbiddenFieldError:
+		errs = []error{err}
+	case *LimitError, *RequestError:
+		// the selection as a whole is invalid, as told by the detail
+	default:
+		return nil
+	}
+	status := selectionStatus(err)
+	p := &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: err.Error(),
+		Errors: []ProblemField{},
+	}
+	pointer := func(index int) string {
+		if param == "" || index < 0 {
+			return ""
+		}
+		return fmt.Sprintf("%s[%d]", param, index)
+	}
+	for _, err := range errs {
+		switch err := err.(type) {
+		case *UnknownFieldError:
+			p.Errors = append(p.Errors, ProblemField{
+				Path:        err.Path,
+				Reason:      ReasonUnknownField,
+				Available:   err.Available,
+				Suggestions: err.Suggestions,
+				Pointer:     pointer(fieldIndex(fields, err.Path, false)),
+			})
+		case *DuplicateFieldError:
+			for _, path := range err.Paths {
+				p.Errors = append(p.Errors, ProblemField{
+					Path:    path,
+					Reason:  ReasonDuplicateField,
+					Pointer: pointer(fieldIndex(fields, path, true)),
+				})
+			}
+		case *UnsupportedTypeError:
+			p.Errors = append(p.Errors, ProblemField{
+				Path:    err.Path,
+				Reason:  ReasonUnsupportedType,
+				Pointer: pointer(fieldIndex(fields, err.Path, false)),
+			})
+		case *ForbiddenFieldError:
+			p.Errors = append(p.Errors, ProblemField{
+				Path:    err.Path,
+				Reason:  ReasonForbiddenField,
+				Pointer: pointer(fieldIndex(fields, err.Path, false)),
+			})
+		}
+	}
+	return p
+}
+
+// selectionStatus returns the HTTP status of a selection error: forbidden if only denied fields are invalid.
+// Other errors, such as MaskerError, are server errors.
+func selectionStatus(err error) int {
+	errs := []error{err}
+	if err, ok := err.(*SelectionError); ok {
+		errs = err.Errors
+	}
+	status := http.StatusForbidden
+	for _, err := range errs {
+		switch err.(type) {
+		case *ForbiddenFieldError:
+		case *UnknownFieldError, *DuplicateFieldError, *UnsupportedTypeError, *LimitError, *RequestError:
+			status = http.StatusBadRequest
+		default:
+			return http.StatusInternalServerError
+		}
+	}
+	return status
+}
+
+// fieldIndex returns the index of the first (or last) field selecting path, or -1.
+func fieldIndex(fields []string, path string, last bool) int {
+	index := -1
+	for i, f := range fields {
+		if f == path || strings.HasPrefix(f, path+".") {
+			index = i
+			if !last {
+				break
+			}
+		}
+	}
+	return index
+}
+
+// Write writes the problem document to w, with the application/problem+json content type.
+func (p *Problem) Write(w http.ResponseWriter) error {
+	buf, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
@@ -0,0 +1,58 @@
+package dynjson
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSelectionProblem(t *testing.T) {
+	fields := []string{"nmae", "quantity", "callback", "quantity", "sub.nam"}
+	_, err := NewFormatter().Format(errorsItem{}, fields)
+	p := SelectionProblem(err, "select", fields)
+	if p == nil {
+		t.Fatal("Expected a problem but returned nil")
+	}
+	w := httptest.NewRecorder()
+	err = p.Write(w)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Returned %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Errorf("Returned '%s', expected '%s'", ct, "application/problem+json")
+	}
+	expected := `{"type":"about:blank","title":"Bad Request","status":400,` +
+		`"detail":"duplicate fields detected: quantity; field 'nmae' does not exist, did you mean 'name'?; field 'callback' has unsupported type func(); field 'sub.nam' does not exist, did you mean 'name'?",` +
+		`"errors":[` +
+		`{"path":"quantity","reason":"duplicate_field","pointer":"select[3]"},` +
+		`{"path":"nmae","reason":"unknown_field","available":["name","quantity","callback","values","sub"],"suggestions":["name"],"pointer":"select[0]"},` +
+		`{"path":"callback","reason":"unsupported_type","pointer":"select[2]"},` +
+		`{"path":"sub.nam","reason":"unknown_field","available":["name","quantity"],"suggestions":["name"],"pointer":"select[4]"}]}` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Returned '%s', expected '%s'", w.Body.String(), expected)
+	}
+	if SelectionProblem(errors.New("database is down"), "select", fields) != nil {
+		t.Error("Expected nil for other errors")
+	}
+}
+
+func TestHandlerProblems(t *testing.T) {
+	h := Handler(func(r *http.Request) (interface{}, error) {
+		return errorsSubItem{}, nil
+	}, HandlerProblems())
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/?select=name&select=quantty", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Returned %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+	expected := `{"type":"about:blank","title":"Bad Request","status":400,"detail":"field 'quantty' does not exist, did you mean 'quantity'?",` +
+		`"errors":[{"path":"quantty","reason":"unknown_field","available":["name","quantity"],"suggestions":["quantity"],"pointer":"select[1]"}]}` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Returned '%s', expected '%s'", w.Body.String(), expected)
+	}
+}
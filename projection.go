@@ -0,0 +1,134 @@
+package dynjson
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"reflect"
+)
+
+// Projection is a selection compiled for values of type T.
+//
+// Unlike Formatter.Format, the type of the formatted values is checked at compile time.
+type Projection[T any] struct {
+	f      *Formatter
+	fields []string
+	elem   formatter
+	slice  formatter
+	cost   int
+	// pii are the paths of the pii fields disclosed, audited by f.
+	pii []string
+}
+
+// Compile compiles the selected fields for values of type T.
+func Compile[T any](fields []string) (*Projection[T], error) {
+	return CompileWith[T](NewFormatter(), fields)
+}
+
+// CompileWith compiles the selected fields for values of type T, using (and populating) the cache of f.
+func CompileWith[T any](f *Formatter, fields []string) (*Projection[T], error) {
+	return CompileWithContext[T](context.Background(), f, fields)
+}
+
+// CompileWithContext is like CompileWith, ctx giving the authorization profile (see WithAuthorizer).
+func CompileWithContext[T any](ctx context.Context, f *Formatter, fields []string) (*Projection[T], error) {
+	p := &Projection[T]{f: f, fields: fields}
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if len(fields) == 0 && !f.restricted(t) {
+		return p, nil
+	}
+	c, err := f.compile(ctx, t, fields)
+	if err != nil {
+		return nil, err
+	}
+	p.elem = c.json()
+	p.cost = c.cost
+	p.pii = c.pii
+	c, err = f.compile(ctx, reflect.SliceOf(t), fields)
+	if err != nil {
+		return nil, err
+	}
+	p.slice = c.json()
+	return p, nil
+}
+
+// Fields returns the fields selected by the projection.
+func (p *Projection[T]) Fields() []string {
+	return p.fields
+}
+
+// Cost returns the cost of the selected fields of a value (see WithFieldCost).
+func (p *Projection[T]) Cost() int {
+	return p.cost
+}
+
+// Format returns v with only the selected fields (or v itself if none specified).
+func (p *Projection[T]) Format(v T) (interface{}, error) {
+	return p.FormatContext(context.Background(), v)
+}
+
+// FormatContext is like Format, the context being available to all the formatting stages.
+func (p *Projection[T]) FormatContext(ctx context.Context, v T) (interface{}, error) {
+	if p.elem == nil {
+		return v, nil
+	}
+	return p.format(ctx, p.elem, reflect.ValueOf(&v).Elem())
+}
+
+// FormatSlice returns s with only the selected fields of its elements (or s itself if none specified).
+func (p *Projection[T]) FormatSlice(s []T) (interface{}, error) {
+	return p.FormatSliceContext(context.Background(), s)
+}
+
+// FormatSliceContext is like FormatSlice, formatting being stopped when ctx is done.
+func (p *Projection[T]) FormatSliceContext(ctx context.Context, s []T) (interface{}, error) {
+	if p.slice == nil {
+		return s, nil
+	}
+	return p.format(ctx, p.slice, reflect.ValueOf(s))
+}
+
+// format formats v with ff, auditing the disclosed pii fields.
+func (p *Projection[T]) format(ctx context.Context, ff formatter, v reflect.Value) (interface{}, error) {
+	o, err := p.formatUnaudited(ctx, ff, v)
+	if err != nil {
+		return nil, err
+	}
+	p.f.auditValue(ctx, p.pii, p.fields, emitted(v, o))
+	return o, nil
+}
+
+// formatUnaudited is like format, for the items of streams which are audited at once.
+func (p *Projection[T]) formatUnaudited(ctx context.Context, ff formatter, v reflect.Value) (interface{}, error) {
+	if ff == nil {
+		return v.Interface(), nil
+	}
+	ctx, _ = p.f.outputContext(ctx)
+	return formatValue(ctx, ff, v)
+}
+
+// Encode writes the JSON encoding of the projection of v to w.
+func (p *Projection[T]) Encode(w io.Writer, v T) error {
+	o, err := p.Format(v)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(o)
+}
+
+// EncodeSlice writes the JSON encoding of the projection of s to w.
+func (p *Projection[T]) EncodeSlice(w io.Writer, s []T) error {
+	o, err := p.FormatSlice(s)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(o)
+}
+
+func formatValue(ctx context.Context, ff formatter, v reflect.Value) (interface{}, error) {
+	v, err := ff.format(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
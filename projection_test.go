@@ -0,0 +1,90 @@
+package dynjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+type projected struct {
+	Foo int    `json:"foo"`
+	Bar string `json:"bar"`
+}
+
+func TestProjection(t *testing.T) {
+	p, err := Compile[projected]([]string{"bar"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	o, err := p.Format(projected{Foo: 1, Bar: "bar"})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	buf, err := json.Marshal(o)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if string(buf) != `{"bar":"bar"}` {
+		t.Errorf("Returned '%s', expected '%s'", string(buf), `{"bar":"bar"}`)
+	}
+	o, err = p.FormatSlice([]projected{{Foo: 1, Bar: "bar"}, {Foo: 2, Bar: "baz"}})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	buf, err = json.Marshal(o)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if string(buf) != `[{"bar":"bar"},{"bar":"baz"}]` {
+		t.Errorf("Returned '%s', expected '%s'", string(buf), `[{"bar":"bar"},{"bar":"baz"}]`)
+	}
+}
+
+func TestProjectionPointer(t *testing.T) {
+	p, err := Compile[*projected]([]string{"foo"})
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	var w bytes.Buffer
+	err = p.EncodeSlice(&w, []*projected{{Foo: 1}, nil})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if w.String() != "[{\"foo\":1},null]\n" {
+		t.Errorf("Returned '%s', expected '%s'", w.String(), "[{\"foo\":1},null]\n")
+	}
+	w.Reset()
+	err = p.Encode(&w, &projected{Foo: 2})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if w.String() != "{\"foo\":2}\n" {
+		t.Errorf("Returned '%s', expected '%s'", w.String(), "{\"foo\":2}\n")
+	}
+}
+
+func TestProjectionNoFields(t *testing.T) {
+	p, err := Compile[projected](nil)
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	src := projected{Foo: 1, Bar: "bar"}
+	o, err := p.Format(src)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if o != src {
+		t.Errorf("Returned '%v', expected '%v'", o, src)
+	}
+}
+
+func TestProjectionError(t *testing.T) {
+	_, err := Compile[projected]([]string{"baz"})
+	if err == nil {
+		t.Fatal("Expected error but returned nil")
+	}
+	msg := "field 'baz' does not exist, did you mean 'bar'?"
+	if err.Error() != msg {
+		t.Errorf("Returned '%s', expected '%s'", err.Error(), msg)
+	}
+}
@@ -0,0 +1,92 @@
+package dynjson
+
+import (
+	"context"
+	"reflect"
+)
+
+// Projector is implemented by types having a ProjectJSON method generated by cmd/dynjsongen.
+//
+// A Formatter uses ProjectJSON instead of reflection to format values implementing Projector,
+// or slices of them, once the selection has been validated.
+type Projector interface {
+	// ProjectJSON writes the JSON encoding of the selected fields of the value to w.
+	ProjectJSON(w *JSONWriter, sel Selection) error
+}
+
+var (
+	projectorType    = reflect.TypeOf((*Projector)(nil)).Elem()
+	reflectFormatter = NewFormatter()
+)
+
+// projectedValue is the JSON marshaler returned when formatting values implementing Projector.
+type projectedValue struct {
+	ctx  context.Context
+	src  reflect.Value
+	sel  Selection
+	each bool
+}
+
+// MarshalJSON implements json.Marshaler.
+func (p projectedValue) MarshalJSON() ([]byte, error) {
+	var w JSONWriter
+	if !p.each {
+		err := project(&w, p.src, p.sel)
+		return w.Bytes(), err
+	}
+	if p.src.IsNil() && len(p.sel) == 0 {
+		w.Raw("null")
+		return w.Bytes(), nil
+	}
+	w.Byte('[')
+	for i := 0; i < p.src.Len(); i++ {
+		if i%cancellationInterval == 0 {
+			if err := p.ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if i > 0 {
+			w.Byte(',')
+		}
+		err := project(&w, p.src.Index(i), p.sel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Byte(']')
+	return w.Bytes(), nil
+}
+
+func project(w *JSONWriter, v reflect.Value, sel Selection) error {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		w.Raw("null")
+		return nil
+	}
+	return v.Interface().(Projector).ProjectJSON(w, sel)
+}
+
+var projectedType = reflect.TypeOf(projectedValue{})
+
+type projectorFormatter struct {
+	sel  Selection
+	each bool
+}
+
+func (f *projectorFormatter) typ() reflect.Type {
+	return projectedType
+}
+
+func (f *projectorFormatter) format(ctx context.Context, src reflect.Value) (reflect.Value, error) {
+	return reflect.ValueOf(projectedValue{ctx: ctx, src: src, sel: f.sel, each: f.each}), nil
+}
+
+// makeProjectorFormatter returns a formatter relying on ProjectJSON if t or its elements implement Projector.
+func makeProjectorFormatter(t reflect.Type, fields []string) formatter {
+	if t.Implements(projectorType) {
+		return &projectorFormatter{sel: ParseSelection(fields)}
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Implements(projectorType) {
+		return &projectorFormatter{sel: ParseSelection(fields), each: true}
+	}
+	return nil
+}
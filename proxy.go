@@ -0,0 +1,236 @@
+package dynjson
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ProxyOption defines a NewProxyFilter option.
+type ProxyOption func(*ProxyFilter)
+
+// ProxyStripSelect removes the query parameters holding the selected fields from the upstream requests.
+func ProxyStripSelect() ProxyOption {
+	return func(p *ProxyFilter) {
+		p.strip = true
+	}
+}
+
+// ProxyMaxBodySize sets the maximum size of the upstream bodies filtered, gzip decoded ones included
+// (DefaultProxyMaxBodySize if 0). Larger bodies are passed through untouched.
+func ProxyMaxBodySize(max int64) ProxyOption {
+	return func(p *ProxyFilter) {
+		p.maxBodySize = max
+	}
+}
+
+// DefaultProxyMaxBodySize is the maximum size of the upstream bodies filtered, unless set by ProxyMaxBodySize.
+const DefaultProxyMaxBodySize = 8 << 20
+
+// ProxyParseOptions sets the options used to get the selected fields from the incoming requests (see ParseRequest).
+func ProxyParseOptions(opts *ParseOptions) ProxyOption {
+	return func(p *ProxyFilter) {
+		p.parse = opts
+	}
+}
+
+// ProxyFilter filters the JSON responses of upstream services proxied by a httputil.ReverseProxy,
+// keeping only the fields selected by the incoming requests (see FilterJSON).
+type ProxyFilter struct {
+	strip       bool
+	parse       *ParseOptions
+	maxBodySize int64
+}
+
+// NewProxyFilter creates a new proxy filter.
+func NewProxyFilter(opts ...ProxyOption) *ProxyFilter {
+	p := &ProxyFilter{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+type proxyFieldsKey struct{}
+
+// proxySelection is the selection of an incoming request, recorded by Director.
+type proxySelection struct {
+	fields []string
+	err    error
+}
+
+// Wrap sets the Director and ModifyResponse functions of proxy, wrapping the existing ones.
+func (p *ProxyFilter) Wrap(proxy *httputil.ReverseProxy) {
+	proxy.Director = p.Director(proxy.Director)
+	if next := proxy.ModifyResponse; next != nil {
+		proxy.ModifyResponse = func(resp *http.Response) error {
+			err := next(resp)
+			if err != nil {
+				return err
+			}
+			return p.ModifyResponse(resp)
+		}
+	} else {
+		proxy.ModifyResponse = p.ModifyResponse
+	}
+}
+
+// Director returns a ReverseProxy director recording the selected fields before calling next,
+// and stripping the parameters holding them afterwards if configured.
+func (p *ProxyFilter) Director(next func(*http.Request)) func(*http.Request) {
+	return func(req *http.Request) {
+		fields, err := ParseRequest(req, p.parse)
+		*req = *req.WithContext(context.WithValue(req.Context(), proxyFieldsKey{}, proxySelection{fields: fields, err: err}))
+		if next != nil {
+			next(req)
+		}
+		if p.strip {
+			req.URL.RawQuery = stripQuery(req.URL.RawQuery, p.parse.params())
+		}
+	}
+}
+
+// ModifyResponse filters successful JSON responses, gzip encoded or not.
+//
+// The selected fields are the ones recorded by Director, or read from the upstream request otherwise.
+// Invalid JSON bodies and bodies exceeding the maximum size (see ProxyMaxBodySize) are passed through untouched,
+// and responses to invalid requests replaced with
+// a 400 problem document (see SelectionProblem).
+func (p *ProxyFilter) ModifyResponse(resp *http.Response) error {
+	if resp.Request == nil {
+		return nil
+	}
+	sel, ok := resp.Request.Context().Value(proxyFieldsKey{}).(proxySelection)
+	if !ok {
+		sel.fields, sel.err = ParseRequest(resp.Request, p.parse)
+	}
+	if sel.err != nil {
+		return replaceWithProblem(resp, SelectionProblem(sel.err, p.parse.params()[0], nil))
+	}
+	fields := sel.fields
+	if len(fields) == 0 || resp.StatusCode < 200 || resp.StatusCode >= 300 || !isJSON(resp.Header.Get("Content-Type")) {
+		return nil
+	}
+	encoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	if encoding != "" && encoding != "identity" && encoding != "gzip" {
+		return nil
+	}
+	max := p.maxBodySize
+	if max <= 0 {
+		max = DefaultProxyMaxBodySize
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > max {
+		// too large to be filtered
+		resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+		return nil
+	}
+	err = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	out, err := filterBody(body, fields, encoding == "gzip", max)
+	if err != nil {
+		out = body
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(out))
+	resp.ContentLength = int64(len(out))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(out)))
+	return nil
+}
+
+// replaceWithProblem replaces the upstream response resp with the problem document pb.
+func replaceWithProblem(resp *http.Response, pb *Problem) error {
+	buf, err := json.Marshal(pb)
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+	err = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.StatusCode = pb.Status
+	resp.Status = strconv.Itoa(pb.Status) + " " + http.StatusText(pb.Status)
+	resp.Header = http.Header{}
+	resp.Header.Set("Content-Type", "application/problem+json")
+	resp.Header.Set("X-Content-Type-Options", "nosniff")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(buf)))
+	resp.Body = io.NopCloser(bytes.NewReader(buf))
+	resp.ContentLength = int64(len(buf))
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// errBodyTooLarge is returned by filterBody when the decoded body exceeds the maximum size.
+var errBodyTooLarge = errors.New("body too large")
+
+// filterBody filters the JSON body, decoding up to max bytes of gzipped ones.
+func filterBody(body []byte, fields []string, gzipped bool, max int64) ([]byte, error) {
+	if !gzipped {
+		return FilterJSON(body, fields)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, errBodyTooLarge
+	}
+	data, err = FilterJSON(data, fields)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// stripQuery removes the parameters named keys from the raw query, keeping the order of the other ones.
+func stripQuery(rawQuery string, keys []string) string {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		k, _, _ := strings.Cut(param, "=")
+		if k, err := url.QueryUnescape(k); err == nil && contains(keys, k) {
+			continue
+		}
+		params = append(params, param)
+	}
+	return strings.Join(params, "&")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
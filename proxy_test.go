@@ -0,0 +1,87 @@
+package dynjson
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestProxyFilter(t *testing.T) {
+	large := "[" + strings.Repeat(`{"foo":1,"bar":2},`, 100) + `{"foo":1,"bar":2}]`
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Query", r.URL.RawQuery)
+		w.Header().Set("Content-Type", "application/json")
+		body := `[{"foo":1,"bar":{"a":1,"b":2}},{"foo":2}]`
+		switch r.URL.Path {
+		case "/large":
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			_, _ = io.WriteString(zw, large)
+			_ = zw.Close()
+		case "/gzip":
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			_, _ = io.WriteString(zw, body)
+			_ = zw.Close()
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"foo":"not found"}`)
+		default:
+			_, _ = io.WriteString(w, body)
+		}
+	}))
+	defer upstream.Close()
+	target, err := url.Parse(upstream.URL)
+	if err != nil {
+		t.Fatal("Should not have returned", err)
+	}
+	var tests = []struct {
+		strip bool
+		parse *ParseOptions
+		max   int64
+		url   string
+		query string
+		body  string
+	}{
+		{url: "/items?select=bar.b&page=2", query: "select=bar.b&page=2", body: `[{"bar":{"b":2}},{}]`},
+		{strip: true, url: "/items?page=2&select=bar.b&select=foo", query: "page=2", body: `[{"bar":{"b":2},"foo":1},{"foo":2}]`},
+		{strip: true, url: "/gzip?select=foo", body: `[{"foo":1},{"foo":2}]`},
+		{strip: true, url: "/items", body: `[{"foo":1,"bar":{"a":1,"b":2}},{"foo":2}]`},
+		{strip: true, url: "/missing?select=bar", body: `{"foo":"not found"}`},
+		{strip: true, parse: &ParseOptions{Params: []string{"fields"}}, url: "/items?fields=foo&select=bar&page=2", query: "select=bar&page=2", body: `[{"foo":1},{"foo":2}]`},
+		{max: 20, url: "/items?select=foo", query: "select=foo", body: `[{"foo":1,"bar":{"a":1,"b":2}},{"foo":2}]`},
+		{max: 1000, url: "/large?select=foo", query: "select=foo", body: large},
+		{max: 2000, url: "/large?select=foo", query: "select=foo", body: "[" + strings.Repeat(`{"foo":1},`, 100) + `{"foo":1}]`},
+		{url: "/items?select=%zz", body: `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid query: invalid URL escape \"%zz\"","errors":[]}` + "\n"},
+	}
+	for _, tt := range tests {
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		opts := []ProxyOption{ProxyParseOptions(tt.parse), ProxyMaxBodySize(tt.max)}
+		if tt.strip {
+			opts = append(opts, ProxyStripSelect())
+		}
+		NewProxyFilter(opts...).Wrap(proxy)
+		front := httptest.NewServer(proxy)
+		resp, err := http.Get(front.URL + tt.url)
+		if err != nil {
+			t.Fatal("Should not have returned", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		resp.Body.Close()
+		front.Close()
+		if string(body) != tt.body {
+			t.Errorf("%s: returned '%s', expected '%s'", tt.url, string(body), tt.body)
+		}
+		if resp.Header.Get("X-Query") != tt.query {
+			t.Errorf("%s: returned '%s', expected '%s'", tt.url, resp.Header.Get("X-Query"), tt.query)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package dynjson
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 )
 
@@ -33,3 +39,204 @@ func FieldsFromRequest(r *http.Request, opt ...Option) []string {
 	}
 	return vals["select"]
 }
+
+// ParseOptions defines how ParseRequest gets the selected fields.
+//
+// When several sources are configured, the first one holding fields is used, in this order:
+// query parameters, Header, Prefer header, then BodyField.
+type ParseOptions struct {
+	// Params are the names of the query parameters holding the selected fields ("select" if empty).
+	Params []string
+	// Header is the name of a header holding comma separated fields (e.g. X-Fields), if any.
+	Header string
+	// Prefer enables reading comma separated fields from the return preference of the Prefer header
+	// (e.g. Prefer: return="foo,bar"), the standard minimal and representation values being ignored.
+	Prefer bool
+	// BodyField is the name of a member of JSON request bodies holding the fields, as an array
+	// or a comma separated string, if any. The body remains available to handlers.
+	BodyField string
+	// MaxBodySize is the maximum size of the bodies read for BodyField (DefaultMaxBodySize if 0),
+	// larger ones being rejected.
+	MaxBodySize int64
+	// MaxLength is the maximum total length of the values holding the fields (unlimited if 0).
+	MaxLength int
+}
+
+// params returns the names of the query parameters holding the selected fields.
+func (o *ParseOptions) params() []string {
+	if o == nil || len(o.Params) == 0 {
+		return []string{"select"}
+	}
+	return o.Params
+}
+
+// DefaultMaxBodySize is the maximum size of the request bodies read by ParseRequest, unless set by ParseOptions.
+const DefaultMaxBodySize = 1 << 20
+
+// RequestError is returned by ParseRequest when the request holding the selection is invalid.
+type RequestError struct {
+	Err error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// ParseRequest returns the list of fields requested from a http.Request, or a RequestError if the request is invalid.
+//
+// Repeated parameters and comma separated values can be mixed, fields being trimmed and empty ones dropped:
+// http://api.example.com/endpoint?select=foo,bar&select=baz
+func ParseRequest(r *http.Request, opts *ParseOptions) ([]string, error) {
+	fields, err := parseRequest(r, opts)
+	if err != nil {
+		return nil, &RequestError{Err: err}
+	}
+	return fields, nil
+}
+
+func parseRequest(r *http.Request, opts *ParseOptions) ([]string, error) {
+	if opts == nil {
+		opts = &ParseOptions{}
+	}
+	vals, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	var values []string
+	for _, param := range opts.params() {
+		values = append(values, vals[param]...)
+	}
+	fields, err := splitFields(values, opts.MaxLength)
+	if len(fields) > 0 || err != nil {
+		return fields, err
+	}
+	if opts.Header != "" {
+		fields, err = splitFields(r.Header.Values(opts.Header), opts.MaxLength)
+		if len(fields) > 0 || err != nil {
+			return fields, err
+		}
+	}
+	if opts.Prefer {
+		fields, err = splitFields(preferredReturn(r.Header.Values("Prefer")), opts.MaxLength)
+		if len(fields) > 0 || err != nil {
+			return fields, err
+		}
+	}
+	if opts.BodyField != "" {
+		max := opts.MaxBodySize
+		if max <= 0 {
+			max = DefaultMaxBodySize
+		}
+		values, err = bodyFields(r, opts.BodyField, max)
+		if err != nil {
+			return nil, err
+		}
+		return splitFields(values, opts.MaxLength)
+	}
+	return nil, nil
+}
+
+// splitFields splits comma separated values into trimmed non empty fields.
+func splitFields(values []string, maxLength int) ([]string, error) {
+	var fields []string
+	length := 0
+	for _, val := range values {
+		length += len(val)
+		if maxLength > 0 && length > maxLength {
+			return nil, fmt.Errorf("selection exceeds %d characters", maxLength)
+		}
+		for _, field := range strings.Split(val, ",") {
+			field = strings.TrimSpace(field)
+			if field != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// preferredReturn returns the values of the return preferences of Prefer headers.
+func preferredReturn(headers []string) []string {
+	var values []string
+	for _, h := range headers {
+		for _, pref := range splitQuoted(h, ',') {
+			// preference parameters follow a semicolon
+			pref = splitQuoted(pref, ';')[0]
+			name, val, ok := strings.Cut(pref, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "return") {
+				continue
+			}
+			val = strings.TrimSpace(val)
+			if unquoted, err := strconv.Unquote(val); err == nil && strings.HasPrefix(val, `"`) {
+				val = unquoted
+			}
+			if val != "minimal" && val != "representation" {
+				values = append(values, val)
+			}
+		}
+	}
+	return values
+}
+
+// splitQuoted splits s around sep, ignoring separators within double quotes.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && s[i] == '\\':
+			escaped = true
+		case s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// bodyFields returns the fields held by the member name of JSON request bodies of up to max bytes, restoring the body.
+// Bodies which are not objects hold no fields.
+func bodyFields(r *http.Request, name string, max int64) ([]string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != "application/json" {
+		return nil, nil
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, max))
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var members map[string]json.RawMessage
+	err = json.Unmarshal(body, &members)
+	if _, ok := err.(*json.UnmarshalTypeError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	val, ok := members[name]
+	if !ok {
+		return nil, nil
+	}
+	var values []string
+	if err := json.Unmarshal(val, &values); err == nil {
+		return values, nil
+	}
+	var value string
+	if err := json.Unmarshal(val, &value); err != nil {
+		return nil, fmt.Errorf("invalid body member '%s': expected an array of strings or a string", name)
+	}
+	return []string{value}, nil
+}
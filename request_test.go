@@ -1,7 +1,10 @@
 package dynjson
 
 import (
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -67,3 +70,123 @@ func TestFieldsFromRequestError(t *testing.T) {
 		t.Error("0 fields were expected")
 	}
 }
+
+func TestParseRequest(t *testing.T) {
+	var tests = []struct {
+		url    string
+		opts   *ParseOptions
+		fields []string
+		err    string
+	}{
+		{url: "/endpoint"},
+		{url: "/endpoint?select=foo&select=bar", fields: []string{"foo", "bar"}},
+		{url: "/endpoint?select=foo,%20bar,,&select=baz&select=", fields: []string{"foo", "bar", "baz"}},
+		{url: "/endpoint?fields=foo&%24select=bar&select=baz", opts: &ParseOptions{Params: []string{"fields", "$select"}}, fields: []string{"foo", "bar"}},
+		{url: "/endpoint?select=foo,bar", opts: &ParseOptions{MaxLength: 7}, fields: []string{"foo", "bar"}},
+		{url: "/endpoint?select=foo,bar&select=b", opts: &ParseOptions{MaxLength: 7}, err: "selection exceeds 7 characters"},
+		{url: "/endpoint?select=ad%f", err: `invalid query: invalid URL escape "%f"`},
+	}
+	for _, tt := range tests {
+		r, err := http.NewRequest(http.MethodGet, "http://api.example.com"+tt.url, nil)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		fields, err := ParseRequest(r, tt.opts)
+		if tt.err != "" {
+			if err == nil {
+				t.Errorf("%s: expected error but returned nil", tt.url)
+			} else if err.Error() != tt.err {
+				t.Errorf("%s: returned '%s', expected '%s'", tt.url, err.Error(), tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if strings.Join(fields, "|") != strings.Join(tt.fields, "|") {
+			t.Errorf("%s: expected %v but got %v", tt.url, tt.fields, fields)
+		}
+	}
+}
+
+func TestParseRequestSources(t *testing.T) {
+	opts := &ParseOptions{Header: "X-Fields", Prefer: true, BodyField: "select", MaxLength: 20}
+	var tests = []struct {
+		url         string
+		headers     map[string]string
+		contentType string
+		body        string
+		fields      []string
+		err         string
+	}{
+		{url: "/endpoint?select=foo", headers: map[string]string{"X-Fields": "bar"}, body: `{"select":["baz"]}`, fields: []string{"foo"}},
+		{url: "/endpoint", headers: map[string]string{"X-Fields": "bar, baz", "Prefer": `return="foo"`}, fields: []string{"bar", "baz"}},
+		{url: "/endpoint", headers: map[string]string{"Prefer": `respond-async, return="foo,bar"; x=1, wait=10`}, body: `{"select":["baz"]}`, fields: []string{"foo", "bar"}},
+		{url: "/endpoint", headers: map[string]string{"Prefer": `return=minimal`}, body: `{"select":["baz","qux.a"]}`, fields: []string{"baz", "qux.a"}},
+		{url: "/endpoint", body: `{"query":"x","select":"baz,qux"}`, fields: []string{"baz", "qux"}},
+		{url: "/endpoint", contentType: "text/plain", body: `{"select":"baz"}`},
+		{url: "/endpoint", body: `{"other":1}`},
+		{url: "/endpoint", body: `[{"select":"baz"}]`},
+		{url: "/endpoint", body: `"select"`},
+		{url: "/endpoint", body: `{"select":1}`, err: "invalid body member 'select': expected an array of strings or a string"},
+		{url: "/endpoint", body: `{"select"`, err: "invalid body: unexpected end of JSON input"},
+		{url: "/endpoint", headers: map[string]string{"X-Fields": "foo,bar,baz,qux,quux,corge"}, err: "selection exceeds 20 characters"},
+	}
+	for _, tt := range tests {
+		var body io.Reader
+		if tt.body != "" {
+			body = strings.NewReader(tt.body)
+		}
+		r, err := http.NewRequest(http.MethodPost, "http://api.example.com"+tt.url, body)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		if tt.contentType == "" {
+			tt.contentType = "application/json; charset=utf-8"
+		}
+		r.Header.Set("Content-Type", tt.contentType)
+		fields, err := ParseRequest(r, opts)
+		if tt.err != "" {
+			if err == nil {
+				t.Errorf("%v: expected error but returned nil", tt.headers)
+			} else if err.Error() != tt.err {
+				t.Errorf("Returned '%s', expected '%s'", err.Error(), tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if strings.Join(fields, "|") != strings.Join(tt.fields, "|") {
+			t.Errorf("%s %v: expected %v but got %v", tt.url, tt.headers, tt.fields, fields)
+		}
+		if r.Body != nil {
+			rest, _ := io.ReadAll(r.Body)
+			if string(rest) != tt.body {
+				t.Errorf("Returned body '%s', expected '%s'", string(rest), tt.body)
+			}
+		}
+	}
+}
+
+func TestParseRequestBodySize(t *testing.T) {
+	body := `{"select":["foo","bar"]}`
+	r := httptest.NewRequest(http.MethodPost, "/endpoint", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	_, err := ParseRequest(r, &ParseOptions{BodyField: "select", MaxBodySize: int64(len(body) - 1)})
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+	r = httptest.NewRequest(http.MethodPost, "/endpoint", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	fields, err := ParseRequest(r, &ParseOptions{BodyField: "select", MaxBodySize: int64(len(body))})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if strings.Join(fields, ",") != "foo,bar" {
+		t.Errorf("Returned %v, expected %v", fields, []string{"foo", "bar"})
+	}
+}
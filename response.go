@@ -0,0 +1,214 @@
+package dynjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrNotAcceptable is returned by Respond when no supported media type is accepted by the client.
+var ErrNotAcceptable = errors.New("no acceptable media type")
+
+// mediaType is a media type Respond can write.
+type mediaType struct {
+	name        string
+	aliases     []string
+	contentType string
+	encode      func(ctx context.Context, f *Formatter, w io.Writer, o interface{}, fields []string) error
+}
+
+// mediaTypes are the media types supported by Respond, in order of preference.
+var mediaTypes = []mediaType{
+	{name: "application/json", contentType: "application/json; charset=utf-8", encode: encodeJSON},
+	{name: "application/x-ndjson", contentType: "application/x-ndjson", encode: encodeNDJSON},
+	{name: "text/csv", contentType: "text/csv; charset=utf-8", encode: func(ctx context.Context, f *Formatter, w io.Writer, o interface{}, fields []string) error {
+		return NewCSVEncoder(w, f).EncodeContext(ctx, o, fields)
+	}},
+	{name: "text/tab-separated-values", contentType: "text/tab-separated-values; charset=utf-8", encode: func(ctx context.Context, f *Formatter, w io.Writer, o interface{}, fields []string) error {
+		return NewTSVEncoder(w, f).EncodeContext(ctx, o, fields)
+	}},
+	{name: "application/xml", aliases: []string{"text/xml"}, contentType: "application/xml; charset=utf-8", encode: func(ctx context.Context, f *Formatter, w io.Writer, o interface{}, fields []string) error {
+		return NewXMLEncoder(w, f).EncodeContext(ctx, o, fields)
+	}},
+	{name: "application/msgpack", aliases: []string{"application/x-msgpack"}, contentType: "application/msgpack", encode: func(ctx context.Context, f *Formatter, w io.Writer, o interface{}, fields []string) error {
+		return NewMsgPackEncoder(w, f).EncodeContext(ctx, o, fields)
+	}},
+	{name: "application/cbor", contentType: "application/cbor", encode: func(ctx context.Context, f *Formatter, w io.Writer, o interface{}, fields []string) error {
+		return NewCBOREncoder(w, f).EncodeContext(ctx, o, fields)
+	}},
+}
+
+var defaultFormatter = NewFormatter()
+
+// Respond writes the selected fields of v (selected by ParseRequest with opts, which may be nil) to w,
+// encoded according to the Accept header of r, using a package-wide formatter.
+//
+// See Formatter.Respond.
+func Respond(w http.ResponseWriter, r *http.Request, v interface{}, opts *ParseOptions) error {
+	return defaultFormatter.Respond(w, r, v, opts)
+}
+
+// Respond writes the selected fields of v (selected by ParseRequest with opts, which may be nil) to w,
+// encoded according to the Accept header of r.
+//
+// Supported media types are application/json (the default), application/x-ndjson (one line per slice element),
+// text/csv, text/tab-separated-values, application/xml, application/msgpack and application/cbor.
+// When none is accepted, a 406 status is sent with the list of supported media types, and ErrNotAcceptable returned.
+// Invalid requests are answered with a 400 problem document (see SelectionProblem), and their RequestError returned.
+//
+// The response is buffered: when formatting fails, nothing is written and the error is returned,
+// so that the caller can send an error status. Truncated responses have the TruncatedHeader set (see TruncateOverflow).
+func (f *Formatter) Respond(w http.ResponseWriter, r *http.Request, v interface{}, opts *ParseOptions) error {
+	fields, err := ParseRequest(r, opts)
+	if err != nil {
+		_ = SelectionProblem(err, opts.params()[0], nil).Write(w)
+		return err
+	}
+	return f.respond(w, r, v, http.StatusOK, fields)
+}
+
+func (f *Formatter) respond(w http.ResponseWriter, r *http.Request, v interface{}, status int, fields []string) error {
+	w.Header().Add("Vary", "Accept")
+	mt := negotiate(r.Header.Values("Accept"))
+	if mt == nil {
+		names := make([]string, len(mediaTypes))
+		for i, mt := range mediaTypes {
+			names[i] = mt.name
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusNotAcceptable)
+		_, err := io.WriteString(w, strings.Join(names, "\n")+"\n")
+		if err != nil {
+			return err
+		}
+		return ErrNotAcceptable
+	}
+	var buf bytes.Buffer
+	ctx, truncated := withTruncationFlag(r.Context())
+	err := mt.encode(ctx, f, &buf, v, fields)
+	if err != nil {
+		return err
+	}
+	if atomic.LoadInt32(truncated) != 0 {
+		w.Header().Set(TruncatedHeader, "true")
+	}
+	w.Header().Set("Content-Type", mt.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// negotiate returns the supported media type with the highest quality in the accept header values,
+// or nil if none is acceptable. Without header, JSON is returned.
+func negotiate(accept []string) *mediaType {
+	var ranges []mediaRange
+	for _, a := range accept {
+		for _, s := range strings.Split(a, ",") {
+			if strings.TrimSpace(s) == "" {
+				continue
+			}
+			if r, ok := parseMediaRange(s); ok {
+				ranges = append(ranges, r)
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return &mediaTypes[0]
+	}
+	var best *mediaType
+	var bestQ float64
+	for i := range mediaTypes {
+		q := quality(ranges, &mediaTypes[i])
+		if q > bestQ {
+			best, bestQ = &mediaTypes[i], q
+		}
+	}
+	return best
+}
+
+// mediaRange is an element of an Accept header.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+func parseMediaRange(s string) (mediaRange, bool) {
+	name, params, err := mime.ParseMediaType(s)
+	if err != nil {
+		return mediaRange{}, false
+	}
+	typ, subtype, ok := strings.Cut(name, "/")
+	if !ok {
+		return mediaRange{}, false
+	}
+	r := mediaRange{typ: typ, subtype: subtype, q: 1}
+	if q, ok := params["q"]; ok {
+		r.q, err = strconv.ParseFloat(q, 64)
+		if err != nil || r.q < 0 || r.q > 1 {
+			return mediaRange{}, false
+		}
+	}
+	return r, true
+}
+
+// quality returns the quality of mt given by its most specific matching range.
+func quality(ranges []mediaRange, mt *mediaType) float64 {
+	q, specificity := 0.0, -1
+	for _, name := range append([]string{mt.name}, mt.aliases...) {
+		typ, subtype, _ := strings.Cut(name, "/")
+		for _, r := range ranges {
+			s := -1
+			switch {
+			case r.typ == typ && r.subtype == subtype:
+				s = 2
+			case r.typ == typ && r.subtype == "*":
+				s = 1
+			case r.typ == "*" && r.subtype == "*":
+				s = 0
+			}
+			if s > specificity || (s == specificity && s >= 0 && r.q > q) {
+				q, specificity = r.q, s
+			}
+		}
+	}
+	return q
+}
+
+func encodeJSON(ctx context.Context, f *Formatter, w io.Writer, o interface{}, fields []string) error {
+	return f.EncodeContext(ctx, w, o, fields)
+}
+
+// encodeNDJSON writes one line per element of slices, or a single line for other values.
+func encodeNDJSON(ctx context.Context, f *Formatter, w io.Writer, o interface{}, fields []string) error {
+	// ProjectJSON based values would be encoded as a single array
+	o, err := f.formatReflect(ctx, o, fields)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f.limitedWriter(w))
+	v := reflect.ValueOf(o)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return enc.Encode(o)
+	}
+	for i := 0; i < v.Len(); i++ {
+		err = enc.Encode(v.Index(i).Interface())
+		if f.truncated(err) {
+			// lines are written as a whole
+			flagTruncation(ctx)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package dynjson
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRespond(t *testing.T) {
+	type Item struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}
+	items := []Item{{Foo: 1, Bar: "a"}, {Foo: 2, Bar: "b"}}
+	var tests = []struct {
+		accept      []string
+		contentType string
+		body        string
+	}{
+		{
+			contentType: "application/json; charset=utf-8",
+			body:        `[{"foo":1},{"foo":2}]` + "\n",
+		},
+		{
+			accept:      []string{"*/*"},
+			contentType: "application/json; charset=utf-8",
+			body:        `[{"foo":1},{"foo":2}]` + "\n",
+		},
+		{
+			accept:      []string{"application/x-ndjson"},
+			contentType: "application/x-ndjson",
+			body:        `{"foo":1}` + "\n" + `{"foo":2}` + "\n",
+		},
+		{
+			accept:      []string{"text/html, text/*;q=0.8, application/json;q=0.5"},
+			contentType: "text/csv; charset=utf-8",
+			body:        "foo\n1\n2\n",
+		},
+		{
+			accept:      []string{"text/html", "text/tab-separated-values"},
+			contentType: "text/tab-separated-values; charset=utf-8",
+			body:        "foo\n1\n2\n",
+		},
+		{
+			accept:      []string{"application/json;q=0, */*;q=0.1"},
+			contentType: "application/x-ndjson",
+			body:        `{"foo":1}` + "\n" + `{"foo":2}` + "\n",
+		},
+		{
+			accept:      []string{"application/msgpack;q=0.9, application/cbor"},
+			contentType: "application/cbor",
+			body:        "\x82\xa1\x63foo\x01\xa1\x63foo\x02",
+		},
+		{
+			accept:      []string{"application/x-msgpack"},
+			contentType: "application/msgpack",
+			body:        "\x92\x81\xa3foo\x01\x81\xa3foo\x02",
+		},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/endpoint?select=foo", nil)
+		for _, a := range tt.accept {
+			r.Header.Add("Accept", a)
+		}
+		w := httptest.NewRecorder()
+		err := Respond(w, r, items, nil)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("Returned %d, expected %d", w.Code, http.StatusOK)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%v: returned '%s', expected '%s'", tt.accept, ct, tt.contentType)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%v: returned '%q', expected '%q'", tt.accept, w.Body.String(), tt.body)
+		}
+	}
+}
+
+func TestRespondXML(t *testing.T) {
+	type Item struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/endpoint?select=bar", nil)
+	r.Header.Set("Accept", "text/xml")
+	w := httptest.NewRecorder()
+	err := NewFormatter().Respond(w, r, Item{Foo: 1, Bar: "a"}, nil)
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/xml; charset=utf-8" {
+		t.Errorf("Returned '%s', expected '%s'", ct, "application/xml; charset=utf-8")
+	}
+	if w.Body.Len() == 0 {
+		t.Error("Expected a body")
+	}
+}
+
+func TestRespondParseOptions(t *testing.T) {
+	type Item struct {
+		Foo int    `json:"foo"`
+		Bar string `json:"bar"`
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://api.example.com/endpoint?select=foo", nil)
+	r.Header.Set("X-Fields", "bar")
+	w := httptest.NewRecorder()
+	err := Respond(w, r, Item{Foo: 1, Bar: "a"}, &ParseOptions{Params: []string{"fields"}, Header: "X-Fields"})
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	if w.Body.String() != `{"bar":"a"}`+"\n" {
+		t.Errorf("Returned '%s', expected '%s'", w.Body.String(), `{"bar":"a"}`+"\n")
+	}
+}
+
+func TestRespondError(t *testing.T) {
+	type Item struct {
+		Foo int `json:"foo"`
+	}
+	{
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/endpoint?select=foo", nil)
+		r.Header.Set("Accept", "text/html, application/json;q=0")
+		w := httptest.NewRecorder()
+		err := Respond(w, r, Item{}, nil)
+		if err != ErrNotAcceptable {
+			t.Errorf("Returned '%v', expected '%v'", err, ErrNotAcceptable)
+		}
+		if w.Code != http.StatusNotAcceptable {
+			t.Errorf("Returned %d, expected %d", w.Code, http.StatusNotAcceptable)
+		}
+		expected := "application/json\napplication/x-ndjson\ntext/csv\ntext/tab-separated-values\napplication/xml\napplication/msgpack\napplication/cbor\n"
+		if w.Body.String() != expected {
+			t.Errorf("Returned '%s', expected '%s'", w.Body.String(), expected)
+		}
+	}
+	{
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/endpoint?select=bar", nil)
+		w := httptest.NewRecorder()
+		err := Respond(w, r, Item{}, nil)
+		if err == nil {
+			t.Error("Expected error but returned nil")
+		}
+		if w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+			t.Error("Nothing should have been written")
+		}
+	}
+	{
+		r := httptest.NewRequest(http.MethodGet, "http://api.example.com/endpoint?select=%zz", nil)
+		w := httptest.NewRecorder()
+		err := Respond(w, r, Item{}, nil)
+		if _, ok := err.(*RequestError); !ok {
+			t.Errorf("Returned '%v', expected a RequestError", err)
+		}
+		if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("Returned %d '%s', expected a 400 problem", w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+}
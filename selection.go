@@ -0,0 +1,63 @@
+package dynjson
+
+import "strings"
+
+// Selection is a tree of selected fields.
+//
+// An empty selection selects all the fields.
+type Selection []SelectedField
+
+// SelectedField is a field of a Selection.
+type SelectedField struct {
+	// Name is the JSON name of the field.
+	Name string
+	// Fields are the selected subfields, or all of them if empty.
+	Fields Selection
+}
+
+// ParseSelection converts a list of dot separated fields into a Selection,
+// keeping the order in which fields first appear.
+func ParseSelection(fields []string) Selection {
+	var sel Selection
+	var subfields [][]string
+	index := map[string]int{}
+	for _, field := range fields {
+		name, rest := field, ""
+		if idx := strings.Index(field, "."); idx != -1 {
+			name, rest = field[:idx], field[idx+1:]
+		}
+		i, found := index[name]
+		if !found {
+			i = len(sel)
+			index[name] = i
+			sel = append(sel, SelectedField{Name: name})
+			subfields = append(subfields, []string{})
+		}
+		if rest == "" {
+			subfields[i] = nil
+		} else if subfields[i] != nil {
+			subfields[i] = append(subfields[i], rest)
+		}
+	}
+	for i := range sel {
+		if len(subfields[i]) > 0 {
+			sel[i].Fields = ParseSelection(subfields[i])
+		}
+	}
+	return sel
+}
+
+// Paths converts the selection back into a list of dot separated fields.
+func (s Selection) Paths() []string {
+	var paths []string
+	for _, f := range s {
+		if len(f.Fields) == 0 {
+			paths = append(paths, f.Name)
+			continue
+		}
+		for _, p := range f.Fields.Paths() {
+			paths = append(paths, f.Name+"."+p)
+		}
+	}
+	return paths
+}
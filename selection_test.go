@@ -0,0 +1,54 @@
+package dynjson
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSelection(t *testing.T) {
+	var tests = []struct {
+		fields string
+		sel    Selection
+	}{
+		{
+			fields: "foo",
+			sel:    Selection{{Name: "foo"}},
+		},
+		{
+			fields: "foo.bar,baz,foo.foo",
+			sel: Selection{
+				{Name: "foo", Fields: Selection{{Name: "bar"}, {Name: "foo"}}},
+				{Name: "baz"},
+			},
+		},
+		{
+			fields: "foo.bar,foo",
+			sel:    Selection{{Name: "foo"}},
+		},
+		{
+			fields: "foo,foo.bar",
+			sel:    Selection{{Name: "foo"}},
+		},
+		{
+			fields: "foo.bar.baz,foo.bar.foo",
+			sel: Selection{
+				{Name: "foo", Fields: Selection{{Name: "bar", Fields: Selection{{Name: "baz"}, {Name: "foo"}}}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		sel := ParseSelection(strings.Split(tt.fields, ","))
+		if !reflect.DeepEqual(sel, tt.sel) {
+			t.Errorf("%s: returned %v, expected %v", tt.fields, sel, tt.sel)
+		}
+	}
+}
+
+func TestSelectionPaths(t *testing.T) {
+	paths := ParseSelection([]string{"foo.bar", "baz", "foo.foo.bar"}).Paths()
+	expected := []string{"foo.bar", "foo.foo.bar", "baz"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Returned %v, expected %v", paths, expected)
+	}
+}
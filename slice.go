@@ -1,43 +1,81 @@
 package dynjson
 
-import "reflect"
+import (
+	"context"
+	"reflect"
+)
 
 type sliceFormatter struct {
-	t    reflect.Type
-	elem formatter
+	t      reflect.Type
+	elem   formatter
+	pool   *workerPool
+	output *outputConfig
 }
 
 func (f *sliceFormatter) typ() reflect.Type {
 	return f.t
 }
 
-func (f *sliceFormatter) format(src reflect.Value) (reflect.Value, error) {
-	dst := reflect.MakeSlice(f.t, src.Len(), src.Len())
-	for i := 0; i < src.Len(); i++ {
-		dv, err := f.elem.format(src.Index(i))
+func (f *sliceFormatter) format(ctx context.Context, src reflect.Value) (reflect.Value, error) {
+	n := src.Len()
+	if f.output != nil {
+		var err error
+		n, err = f.output.limit(ctx, n)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	dst := reflect.MakeSlice(f.t, n, n)
+	if f.pool != nil && n >= f.pool.threshold {
+		return dst, f.pool.run(n, func(start, end int) error {
+			return f.formatRange(ctx, src, dst, start, end)
+		})
+	}
+	return dst, f.formatRange(ctx, src, dst, 0, n)
+}
+
+// cancellationInterval is the number of slice elements formatted between two checks of the context.
+const cancellationInterval = 256
+
+func (f *sliceFormatter) formatRange(ctx context.Context, src, dst reflect.Value, start, end int) error {
+	for i := start; i < end; i++ {
+		if (i-start)%cancellationInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		dv, err := f.elem.format(ctx, src.Index(i))
 		if err != nil {
-			return dv, err
+			return err
 		}
 		dst.Index(i).Set(dv)
 	}
-	return dst, nil
+	return nil
 }
 
 type sliceBuilder struct {
 	t    reflect.Type
-	elem *structBuilder
+	elem builder
 }
 
-func (b *sliceBuilder) build(fields []string, prefix string) (formatter, error) {
-	et, err := b.elem.build(fields, prefix)
+func (b *sliceBuilder) build(c *compilation, fields []string, prefix string) (formatter, error) {
+	factor := c.factor
+	c.factor *= c.sliceMul
+	et, err := b.elem.build(c, fields, prefix)
+	c.factor = factor
 	if err != nil {
 		return nil, err
 	}
-	return &sliceFormatter{t: reflect.SliceOf(et.typ()), elem: et}, nil
+	pool := c.pool
+	if c.output != nil && c.output.limits.MaxElements > 0 {
+		// elements are counted in order, so that each call keeps the same ones
+		pool = nil
+	}
+	return &sliceFormatter{t: reflect.SliceOf(et.typ()), elem: et, pool: pool, output: c.output}, nil
 }
 
-func makeSliceBuilder(t reflect.Type) (*sliceBuilder, error) {
-	elemBuilder, err := makeStructBuilder(t.Elem())
+func makeSliceBuilder(t reflect.Type, building map[reflect.Type]bool) (*sliceBuilder, error) {
+	elemBuilder, err := makeBuilder(t.Elem(), building)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,186 @@
+package dynjson
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+)
+
+// StreamOption defines an EncodeStream option.
+type StreamOption func(*streamOptions)
+
+type streamOptions struct {
+	ctx       context.Context
+	formatter *Formatter
+	ndjson    bool
+	report    *Report
+}
+
+// StreamNDJSON writes newline delimited JSON instead of a JSON array.
+func StreamNDJSON() StreamOption {
+	return func(o *streamOptions) {
+		o.ndjson = true
+	}
+}
+
+// StreamFormatter compiles the selection with f, and its cache, instead of a new formatter.
+func StreamFormatter(f *Formatter) StreamOption {
+	return func(o *streamOptions) {
+		o.formatter = f
+	}
+}
+
+// StreamReport makes the stream fill the Cost and Truncated fields of r (see Report).
+func StreamReport(r *Report) StreamOption {
+	return func(o *streamOptions) {
+		o.report = r
+	}
+}
+
+// StreamContext stops the encoding, returning the context error, when ctx is done.
+// The context is also available to all the formatting stages.
+func StreamContext(ctx context.Context) StreamOption {
+	return func(o *streamOptions) {
+		o.ctx = ctx
+	}
+}
+
+// EncodeStream writes the selected fields of the items returned by next to w,
+// as a JSON array (or as newline delimited JSON with StreamNDJSON), until next returns false or an error.
+//
+// Each item is written, and w flushed if it implements http.Flusher or has a Flush() error method,
+// as soon as it is produced. If an error occurs, the output written so far is left incomplete.
+// Items exceeding the MaxBytes output limit of the formatter end the stream with TruncateOverflow (see StreamReport).
+func EncodeStream[T any](w io.Writer, next func() (T, bool, error), fields []string, opts ...StreamOption) error {
+	o := streamOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.formatter == nil {
+		o.formatter = NewFormatter()
+	}
+	p, err := CompileWithContext[T](o.ctx, o.formatter, fields)
+	if err != nil {
+		return err
+	}
+	if o.report == nil {
+		return p.encodeStream(o.ctx, w, next, o.ndjson)
+	}
+	o.report.Cost += p.cost
+	ctx, truncated := withTruncationFlag(o.ctx)
+	err = p.encodeStream(ctx, w, next, o.ndjson)
+	if atomic.LoadInt32(truncated) != 0 {
+		o.report.Truncated = true
+	}
+	return err
+}
+
+// EncodeChan is like EncodeStream, the items being received from ch until it is closed,
+// or until the context of StreamContext is done while waiting for them.
+func EncodeChan[T any](w io.Writer, ch <-chan T, fields []string, opts ...StreamOption) error {
+	o := streamOptions{ctx: context.Background()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return EncodeStream(w, func() (T, bool, error) {
+		select {
+		case v, ok := <-ch:
+			return v, ok, nil
+		case <-o.ctx.Done():
+			var v T
+			return v, false, o.ctx.Err()
+		}
+	}, fields, opts...)
+}
+
+func (p *Projection[T]) encodeStream(ctx context.Context, w io.Writer, next func() (T, bool, error), ndjson bool) error {
+	audit := &streamAudit{f: p.f, pii: p.pii, fields: p.fields}
+	defer audit.done(ctx)
+	w = p.f.limitedWriter(w)
+	lw, _ := w.(*limitWriter)
+	if lw != nil && !ndjson {
+		lw.reserve = len("]\n")
+	}
+	end := func(i int) error {
+		if ndjson {
+			return nil
+		}
+		if lw != nil {
+			lw.reserve = 0
+		}
+		if i == 0 {
+			_, err := io.WriteString(w, "[")
+			if err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "]\n")
+		if err != nil {
+			return err
+		}
+		return flush(w)
+	}
+	enc := json.NewEncoder(w)
+	for i := 0; ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		v, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return end(i)
+		}
+		rv := reflect.ValueOf(&v).Elem()
+		o, err := p.formatUnaudited(ctx, p.elem, rv)
+		if err != nil {
+			return err
+		}
+		if ndjson {
+			err = enc.Encode(o)
+		} else {
+			err = writeArrayItem(w, i, o)
+		}
+		if p.f.truncated(err) {
+			// items are written as a whole
+			flagTruncation(ctx)
+			return end(i)
+		}
+		if err != nil {
+			return err
+		}
+		audit.add(rv)
+		err = flush(w)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeArrayItem(w io.Writer, i int, o interface{}) error {
+	buf, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	sep := ","
+	if i == 0 {
+		sep = "["
+	}
+	_, err = w.Write(append([]byte(sep), buf...))
+	return err
+}
+
+// flush flushes w if it supports it.
+func flush(w io.Writer) error {
+	switch w := w.(type) {
+	case http.Flusher:
+		w.Flush()
+	case interface{ Flush() error }:
+		return w.Flush()
+	}
+	return nil
+}
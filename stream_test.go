@@ -0,0 +1,96 @@
+package dynjson
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type streamed struct {
+	Foo int    `json:"foo"`
+	Bar string `json:"bar"`
+}
+
+func iterate(items []streamed, err error) func() (streamed, bool, error) {
+	return func() (streamed, bool, error) {
+		if len(items) == 0 {
+			return streamed{}, false, err
+		}
+		v := items[0]
+		items = items[1:]
+		return v, true, nil
+	}
+}
+
+func TestEncodeStream(t *testing.T) {
+	items := []streamed{{Foo: 1, Bar: "a"}, {Foo: 2, Bar: "b"}}
+	var tests = []struct {
+		items  []streamed
+		opts   []StreamOption
+		output string
+	}{
+		{items: items, output: "[{\"foo\":1},{\"foo\":2}]\n"},
+		{items: nil, output: "[]\n"},
+		{items: items, opts: []StreamOption{StreamNDJSON()}, output: "{\"foo\":1}\n{\"foo\":2}\n"},
+		{items: nil, opts: []StreamOption{StreamNDJSON()}, output: ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		err := EncodeStream(w, iterate(tt.items, nil), []string{"foo"}, tt.opts...)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if w.Body.String() != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", w.Body.String(), tt.output)
+		}
+		if tt.output != "" && !w.Flushed {
+			t.Error("Should have flushed")
+		}
+	}
+}
+
+func TestEncodeStreamError(t *testing.T) {
+	var w bytes.Buffer
+	expected := errors.New("cursor error")
+	err := EncodeStream(&w, iterate([]streamed{{Foo: 1}}, expected), []string{"foo"})
+	if err != expected {
+		t.Errorf("Returned '%v', expected '%v'", err, expected)
+	}
+	err = EncodeStream(&w, iterate(nil, nil), []string{"baz"})
+	if err == nil {
+		t.Error("Expected error but returned nil")
+	}
+}
+
+func TestEncodeChan(t *testing.T) {
+	ch := make(chan streamed)
+	go func() {
+		for i := 0; i < 3; i++ {
+			ch <- streamed{Foo: i, Bar: "bar"}
+		}
+		close(ch)
+	}()
+	var w bytes.Buffer
+	err := EncodeChan(&w, ch, []string{"bar", "foo"}, StreamNDJSON(), StreamFormatter(NewFormatter(WithObjects())))
+	if err != nil {
+		t.Error("Should not have returned", err)
+	}
+	expected := "{\"bar\":\"bar\",\"foo\":0}\n{\"bar\":\"bar\",\"foo\":1}\n{\"bar\":\"bar\",\"foo\":2}\n"
+	if w.String() != expected {
+		t.Errorf("Returned '%s', expected '%s'", w.String(), expected)
+	}
+}
+
+func TestEncodeChanCancel(t *testing.T) {
+	ch := make(chan streamed)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var w bytes.Buffer
+	err := EncodeChan(&w, ch, []string{"foo"}, StreamContext(ctx))
+	if err != context.DeadlineExceeded {
+		t.Errorf("Returned '%v', expected '%v'", err, context.DeadlineExceeded)
+	}
+}
@@ -1,11 +1,16 @@
 package dynjson
 
 import (
-	"fmt"
+	"context"
+	"encoding/xml"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 )
 
+var xmlNameType = reflect.TypeOf(xml.Name{})
+
 type mapping struct {
 	src    reflect.StructField
 	dst    reflect.StructField
@@ -21,12 +26,12 @@ func (f *structFormatter) typ() reflect.Type {
 	return f.t
 }
 
-func (f *structFormatter) format(src reflect.Value) (reflect.Value, error) {
+func (f *structFormatter) format(ctx context.Context, src reflect.Value) (reflect.Value, error) {
 	pdst := reflect.New(f.t)
 	dst := pdst.Elem()
 	for key := range f.mappings {
 		sv := src.FieldByIndex(f.mappings[key].src.Index)
-		dv, err := f.mappings[key].format.format(sv)
+		dv, err := f.mappings[key].format.format(ctx, sv)
 		if err != nil {
 			return reflect.Value{}, err
 		}
@@ -37,48 +42,141 @@ func (f *structFormatter) format(src reflect.Value) (reflect.Value, error) {
 
 type structBuilder struct {
 	t        reflect.Type
+	names    []string
 	builders map[string]builder
 	tags     map[string]string
 	fields   map[string]reflect.StructField
+	costs    map[string]int
+	// masks are the names of the maskers of the fields, from their dynjson:"mask=name" tags.
+	masks map[string]string
+	// pii tells which fields are tagged with dynjson:"pii".
+	pii     map[string]bool
+	xmlName *reflect.StructField
 }
 
-func (b *structBuilder) build(fields []string, prefix string) (formatter, error) {
+func (b *structBuilder) build(c *compilation, fields []string, prefix string) (formatter, error) {
 	if len(fields) == 0 {
-		return &primitiveFormatter{t: b.t}, nil
+		if b.unrestricted(c, prefix) {
+			c.cost += fieldsCost(c, b, c.factor)
+			if structOf(b) != nil {
+				c.count += len(leaves(b, prefix))
+			}
+			return &primitiveFormatter{t: b.t}, nil
+		}
+		fields = b.authorizedFields(c, prefix)
+		c.expanded = true
 	}
-	err := detectDuplicateFields(fields)
-	if err != nil {
-		return nil, err
+	var errs []error
+	if err := detectDuplicateFields(fields, prefix); err != nil {
+		errs = append(errs, err)
 	}
 	var lf []reflect.StructField
+	var members []member
 	mappings := map[string]mapping{}
+	// done holds the fields already handled, for fields selected with several subfields
+	done := map[string]bool{}
+	if b.xmlName != nil && !c.objects {
+		sf := reflect.StructField{
+			Name: b.xmlName.Name,
+			Tag:  reflect.StructTag(`json:"-" xml:"` + b.xmlName.Tag.Get("xml") + `"`),
+			Type: xmlNameType,
+		}
+		lf = append(lf, sf)
+		sf.Index = []int{len(lf) - 1}
+		// the empty key cannot be a field name
+		mappings[""] = mapping{
+			src:    *b.xmlName,
+			dst:    sf,
+			format: &primitiveFormatter{t: xmlNameType},
+		}
+	}
 	for _, field := range fields {
 		var (
 			subfields []string
 		)
 		if idx := strings.Index(field, "."); idx != -1 {
 			tag := field[:idx]
-			if _, found := mappings[tag]; found {
+			if done[tag] {
 				continue
 			}
+			seen := map[string]bool{}
 			for _, subfield := range fields {
-				if strings.HasPrefix(subfield, field[:idx+1]) {
+				// duplicates are reported once, at this level
+				if strings.HasPrefix(subfield, field[:idx+1]) && !seen[subfield] {
+					seen[subfield] = true
 					subfields = append(subfields, subfield[idx+1:])
 				}
 			}
 			field = tag
+		} else if done[field] {
+			continue
 		}
+		done[field] = true
 		subb := b.builders[field]
 		if subb == nil {
-			return nil, fmt.Errorf("field '%s' does not exist", prefix+field)
+			if c.lenient {
+				c.ignored = append(c.ignored, prefix+field)
+				continue
+			}
+			errs = append(errs, &UnknownFieldError{
+				Path:        prefix + field,
+				Available:   b.names,
+				Suggestions: suggest(field, b.names),
+			})
+			continue
 		}
-		fmter, err := subb.build(subfields, prefix+field+".")
+		if !c.authorize(b.t, prefix+field) {
+			if c.drop {
+				c.denied = append(c.denied, prefix+field)
+				continue
+			}
+			errs = append(errs, &ForbiddenFieldError{Path: prefix + field})
+			continue
+		}
+		ignored, denied, selected, count := len(c.ignored), len(c.denied), len(c.selected), c.count
+		fmter, err := subb.build(c, subfields, prefix+field+".")
 		if err != nil {
-			return nil, err
+			errs = appendError(errs, err)
+			continue
+		}
+		if len(subfields) > 0 && len(withoutPaths(withoutPaths(subfields,
+			trimPrefixes(c.ignored[ignored:], prefix+field+".")),
+			trimPrefixes(c.denied[denied:], prefix+field+"."))) == 0 {
+			// all the subfields are unknown or denied
+			continue
+		}
+		if len(c.selected) == selected {
+			c.selected = append(c.selected, prefix+field)
+		}
+		if c.count == count {
+			c.count++
+		}
+		tag := b.tags[field]
+		if c.masked(b.t, prefix+field, b.masks[field]) {
+			fmter, err = c.mask(b.fields[field].Type, prefix+field, b.masks[field])
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			// masked values are already strings
+			tag = withoutTagOption(tag, "string")
+		} else if b.pii[field] {
+			c.pii = append(c.pii, prefix+field)
+		}
+		c.cost += c.factor * b.cost(c, field)
+		if c.objects {
+			members = append(members, member{
+				key:       field,
+				src:       b.fields[field].Index,
+				omitEmpty: hasTagOption(b.tags[field], "omitempty"),
+				quoted:    hasTagOption(tag, "string"),
+				format:    fmter,
+			})
+			continue
 		}
 		sf := reflect.StructField{
 			Name:      strings.ToUpper(field),
-			Tag:       reflect.StructTag(`json:"` + b.tags[field] + `"`),
+			Tag:       reflect.StructTag(`json:"` + tag + `" xml:"` + b.xmlTag(field) + `"`),
 			Type:      fmter.typ(),
 			Anonymous: b.fields[field].Anonymous,
 		}
@@ -90,21 +188,35 @@ func (b *structBuilder) build(fields []string, prefix string) (formatter, error)
 			format: fmter,
 		}
 	}
+	if err := joinErrors(errs); err != nil {
+		return nil, err
+	}
+	if c.objects {
+		return &objectFormatter{members: members}, nil
+	}
 	return &structFormatter{t: reflect.StructOf(lf), mappings: mappings}, nil
 }
 
-func makeStructBuilder(t reflect.Type) (*structBuilder, error) {
-	sb := structBuilder{
+func makeStructBuilder(t reflect.Type, building map[reflect.Type]bool) (*structBuilder, error) {
+	building[t] = true
+	defer delete(building, t)
+	sb := &structBuilder{
 		t:        t,
 		builders: map[string]builder{},
 		tags:     map[string]string{},
 		fields:   map[string]reflect.StructField{},
+		costs:    map[string]int{},
+		masks:    map[string]string{},
+		pii:      map[string]bool{},
 	}
 	for i := 0; i < t.NumField(); i++ {
 		fld := t.Field(i)
 		if fld.Type.Kind() == reflect.Ptr && fld.Type.Elem() == t {
 			continue
 		}
+		if fld.Name == "XMLName" && fld.Type == xmlNameType {
+			sb.xmlName = &fld
+		}
 		tag := fld.Tag.Get("json")
 		if tag == "-" || fld.PkgPath != "" {
 			continue
@@ -116,19 +228,104 @@ func makeStructBuilder(t reflect.Type) (*structBuilder, error) {
 		if idx := strings.Index(field, ","); idx != -1 {
 			field = field[:idx]
 		}
-		ssb, err := makeBuilder(fld.Type)
+		ssb, err := makeBuilder(fld.Type, building)
 		if err != nil {
 			return nil, err
 		}
+		sb.names = append(sb.names, field)
 		sb.builders[field] = ssb
 		sb.tags[field] = tag
 		sb.fields[field] = fld
+		if cost, ok := tagCost(fld.Tag.Get("dynjson")); ok {
+			sb.costs[field] = cost
+		}
+		if mask, ok := tagOption(fld.Tag.Get("dynjson"), "mask"); ok {
+			sb.masks[field] = mask
+		}
+		if hasDynjsonOption(fld.Tag.Get("dynjson"), "pii") {
+			sb.pii[field] = true
+		}
 	}
-	return &sb, nil
+	return sb, nil
+}
+
+// cost returns the cost of field: the registered one, the one of its dynjson tag, or 1.
+func (b *structBuilder) cost(c *compilation, field string) int {
+	if cost, ok := c.costs[b.t][field]; ok {
+		return cost
+	}
+	if cost, ok := b.costs[field]; ok {
+		return cost
+	}
+	return 1
+}
+
+// fieldsCost returns the cost of all the fields under b, output when selecting b as a whole,
+// factor multiplying the cost of the fields of b.
+func fieldsCost(c *compilation, b builder, factor int) int {
+	switch b := b.(type) {
+	case *structBuilder:
+		cost := 0
+		for _, name := range b.names {
+			cost += factor*b.cost(c, name) + fieldsCost(c, b.builders[name], factor)
+		}
+		return cost
+	case *pointerBuilder:
+		return fieldsCost(c, b.elem, factor)
+	case *sliceBuilder:
+		return fieldsCost(c, b.elem, factor*c.sliceMul)
+	}
+	return 0
+}
+
+// tagCost returns the cost option of a dynjson tag, if any.
+func tagCost(tag string) (int, bool) {
+	opt, ok := tagOption(tag, "cost")
+	if !ok {
+		return 0, false
+	}
+	cost, err := strconv.Atoi(opt)
+	return cost, err == nil && cost >= 0
+}
+
+// tagOption returns the value of the name=value option of a dynjson tag, if any.
+func tagOption(tag, name string) (string, bool) {
+	for _, opt := range strings.Split(tag, ",") {
+		if strings.HasPrefix(opt, name+"=") {
+			return strings.TrimPrefix(opt, name+"="), true
+		}
+	}
+	return "", false
+}
+
+// hasTagged reports whether tagged returns true for b or the struct builders under it.
+func hasTagged(b builder, tagged func(*structBuilder) bool) bool {
+	sb := structOf(b)
+	if sb == nil {
+		return false
+	}
+	if tagged(sb) {
+		return true
+	}
+	for _, name := range sb.names {
+		if hasTagged(sb.builders[name], tagged) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimPrefixes returns paths without prefix.
+func trimPrefixes(paths []string, prefix string) []string {
+	trimmed := make([]string, len(paths))
+	for i, path := range paths {
+		trimmed[i] = strings.TrimPrefix(path, prefix)
+	}
+	return trimmed
 }
 
 // detectDuplicateFields returns an error if passed the same field more than once.
-func detectDuplicateFields(fields []string) error {
+func detectDuplicateFields(fields []string, prefix string) error {
 	h := make(map[string]int)
 	for _, f := range fields {
 		h[f]++
@@ -136,11 +333,56 @@ func detectDuplicateFields(fields []string) error {
 	var e []string
 	for f, count := range h {
 		if count > 1 {
-			e = append(e, f)
+			e = append(e, prefix+f)
 		}
 	}
 	if len(e) > 0 {
-		return fmt.Errorf("duplicate fields detected: %s", strings.Join(e, ", "))
+		sort.Strings(e)
+		return &DuplicateFieldError{Paths: e}
 	}
 	return nil
 }
+
+// xmlTag returns the xml tag of field, defaulting to its JSON name.
+func (b *structBuilder) xmlTag(field string) string {
+	if tag, ok := b.fields[field].Tag.Lookup("xml"); ok {
+		return tag
+	}
+	if hasTagOption(b.tags[field], "omitempty") {
+		return field + ",omitempty"
+	}
+	return field
+}
+
+// hasDynjsonOption reports whether the dynjson tag contains the given option.
+func hasDynjsonOption(tag, option string) bool {
+	for _, opt := range strings.Split(tag, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutTagOption returns the json tag without the given option.
+func withoutTagOption(tag, option string) string {
+	opts := strings.Split(tag, ",")
+	kept := opts[:1]
+	for _, opt := range opts[1:] {
+		if opt != option {
+			kept = append(kept, opt)
+		}
+	}
+	return strings.Join(kept, ",")
+}
+
+// hasTagOption reports whether the json tag contains the given option.
+func hasTagOption(tag, option string) bool {
+	opts := strings.Split(tag, ",")
+	for _, opt := range opts[1:] {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
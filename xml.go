@@ -0,0 +1,127 @@
+package dynjson
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"reflect"
+)
+
+// XMLEncoder writes the selected fields of structs, or slices of structs, as XML.
+//
+// The xml tags of the fields are honored (names, attributes, chardata...), fields without xml tag
+// being named after their JSON name. Elements are named after the XMLName field of the struct,
+// or its type name.
+type XMLEncoder struct {
+	f    *Formatter
+	enc  *xml.Encoder
+	root string
+}
+
+// NewXMLEncoder returns a new encoder writing to w, using f (or a new formatter if nil).
+func NewXMLEncoder(w io.Writer, f *Formatter) *XMLEncoder {
+	if f == nil {
+		f = NewFormatter()
+	}
+	return &XMLEncoder{f: f, enc: xml.NewEncoder(f.limitedWriter(w))}
+}
+
+// Indent sets the indentation, as xml.Encoder.Indent.
+func (e *XMLEncoder) Indent(prefix, indent string) {
+	e.enc.Indent(prefix, indent)
+}
+
+// SetRoot wraps the encoded values in a root element, needed to get a well-formed document from a slice.
+func (e *XMLEncoder) SetRoot(name string) {
+	e.root = name
+}
+
+// Encode writes the XML encoding of the selected fields of o (or all of them if none specified).
+func (e *XMLEncoder) Encode(o interface{}, fields []string) error {
+	return e.EncodeContext(context.Background(), o, fields)
+}
+
+// EncodeContext is like Encode, the context being available to all the formatting stages.
+func (e *XMLEncoder) EncodeContext(ctx context.Context, o interface{}, fields []string) error {
+	if o == nil {
+		// as with encoding/xml, nil values have no elements
+		if e.root != "" {
+			err := e.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: e.root}})
+			if err != nil {
+				return err
+			}
+			err = e.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: e.root}})
+			if err != nil {
+				return err
+			}
+		}
+		return e.enc.Flush()
+	}
+	t := reflect.TypeOf(o)
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	b, err := e.f.builder(t)
+	if err != nil {
+		return err
+	}
+	if e.f.restricted(reflect.TypeOf(o)) {
+		selected, err := e.f.selectedFields(ctx, reflect.TypeOf(o), fields)
+		if err != nil {
+			return err
+		}
+		if len(selected) > 0 || len(fields) == 0 {
+			fields = selected
+		}
+	}
+	if structOf(b) != nil {
+		// synthesized structs get xml tags defaulting to JSON names, including nested ones
+		fields = expandFields(b, fields)
+	}
+	fo, err := e.f.formatReflect(ctx, o, fields)
+	if err != nil {
+		return err
+	}
+	if e.root != "" {
+		err = e.enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: e.root}})
+		if err != nil {
+			return err
+		}
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if _, found := t.FieldByName("XMLName"); t.Kind() == reflect.Struct && !found && t.Name() != "" {
+		err = e.enc.EncodeElement(fo, xml.StartElement{Name: xml.Name{Local: t.Name()}})
+	} else {
+		err = e.enc.Encode(fo)
+	}
+	if err != nil {
+		return err
+	}
+	if e.root != "" {
+		err = e.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: e.root}})
+		if err != nil {
+			return err
+		}
+	}
+	return e.enc.Flush()
+}
+
+// MarshalXML implements xml.Marshaler, members being encoded as child elements named after their keys.
+func (o Object) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if o == nil {
+		return nil
+	}
+	err := e.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	for _, m := range o {
+		err = e.EncodeElement(m.Value, xml.StartElement{Name: xml.Name{Local: m.Key}})
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
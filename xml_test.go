@@ -0,0 +1,91 @@
+package dynjson
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+type xmlCustomer struct {
+	ID   int    `json:"id" xml:"id,attr"`
+	Name string `json:"name" xml:",chardata"`
+}
+
+type xmlOrder struct {
+	XMLName  xml.Name    `json:"-" xml:"order"`
+	ID       int         `json:"id" xml:"id,attr"`
+	Customer xmlCustomer `json:"customer" xml:"buyer"`
+	Total    float64     `json:"total"`
+	Note     string      `json:"note,omitempty"`
+	Secret   string      `json:"secret" xml:"-"`
+}
+
+type xmlItem struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"qty" xml:"quantity"`
+}
+
+func TestXMLEncoder(t *testing.T) {
+	order := xmlOrder{ID: 1, Customer: xmlCustomer{ID: 2, Name: "Jane"}, Total: 12.5, Secret: "secret"}
+	var tests = []struct {
+		src     interface{}
+		fields  []string
+		root    string
+		objects bool
+		output  string
+	}{
+		{
+			src:    order,
+			fields: []string{"total", "customer.name", "id", "note", "secret"},
+			output: `<order id="1"><total>12.5</total><buyer>Jane</buyer></order>`,
+		},
+		{
+			src:    &order,
+			fields: []string{"customer"},
+			output: `<order><buyer id="2">Jane</buyer></order>`,
+		},
+		{
+			src:    order,
+			fields: nil,
+			output: `<order id="1"><buyer id="2">Jane</buyer><total>12.5</total></order>`,
+		},
+		{
+			src:    []xmlItem{{SKU: "a", Quantity: 1}, {SKU: "b", Quantity: 2}},
+			fields: []string{"qty"},
+			root:   "items",
+			output: `<items><xmlItem><quantity>1</quantity></xmlItem><xmlItem><quantity>2</quantity></xmlItem></items>`,
+		},
+		{
+			src:     xmlItem{SKU: "a", Quantity: 1},
+			fields:  []string{"qty", "sku"},
+			objects: true,
+			output:  `<xmlItem><qty>1</qty><sku>a</sku></xmlItem>`,
+		},
+		{
+			src:    nil,
+			fields: []string{"id"},
+			output: ``,
+		},
+		{
+			src:    nil,
+			root:   "items",
+			output: `<items></items>`,
+		},
+	}
+	for _, tt := range tests {
+		var w bytes.Buffer
+		f := NewFormatter()
+		if tt.objects {
+			f = NewFormatter(WithObjects())
+		}
+		e := NewXMLEncoder(&w, f)
+		e.SetRoot(tt.root)
+		err := e.Encode(tt.src, tt.fields)
+		if err != nil {
+			t.Error("Should not have returned", err)
+		}
+		if w.String() != tt.output {
+			t.Errorf("Returned '%s', expected '%s'", w.String(), tt.output)
+		}
+	}
+}